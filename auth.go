@@ -0,0 +1,184 @@
+package core
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Principal is the authenticated identity of a request, it is stored on Context by the auth middlewares.
+type Principal struct {
+	ID     string                 // user id, user name or api key owner
+	Scheme string                 // authentication scheme: Bearer, Basic, ApiKey, Session
+	Roles  []string               // roles granted to the principal
+	Claims map[string]interface{} // raw claims or attributes of the principal
+}
+
+// HasRole tells if the principal has the role.
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// challenge build a WWW-Authenticate header value.
+func challenge(scheme, realm string, params ...string) string {
+	c := scheme + " realm=" + quote(realm)
+	for i := 0; i+1 < len(params); i += 2 {
+		if params[i+1] == "" {
+			continue
+		}
+		c += ", " + params[i] + "=" + quote(params[i+1])
+	}
+	return c
+}
+
+func quote(s string) string {
+	return `"` + strings.Replace(strings.Replace(s, `\`, `\\`, -1), `"`, `\"`, -1) + `"`
+}
+
+// secureCompare compares two strings in constant time, their digests are compared so that the length of actual does not leak.
+func secureCompare(given, actual string) bool {
+	g, a := sha256.Sum256([]byte(given)), sha256.Sum256([]byte(actual))
+	return subtle.ConstantTimeCompare(g[:], a[:]) == 1
+}
+
+// authFail responds the auth error, errors not created by the auth middlewares are wrapped into an AuthError.
+func authFail(ctx *Context, challenge string, err error) {
+	if _, ok := err.(ICoreError); ok == false {
+		err = (&AuthError{}).New(http.StatusUnauthorized, challenge, err.Error())
+	}
+	ctx.Fail(err)
+}
+
+// BasicAuth returns a middleware that authenticates requests with HTTP Basic auth.
+// accounts maps user names to passwords, passwords are compared in constant time.
+func BasicAuth(realm string, accounts map[string]string) RouterHandler {
+	return BasicAuthFunc(realm, func(user, password string) (*Principal, error) {
+		// Compare against an empty password for unknown users to keep the timing flat.
+		actual, ok := accounts[user]
+		if secureCompare(password, actual) == false || ok == false {
+			return nil, nil
+		}
+		return &Principal{ID: user}, nil
+	})
+}
+
+// BasicAuthFunc returns a middleware that authenticates requests with HTTP Basic auth.
+// validate returns nil principal for bad credentials, or an error to respond.
+func BasicAuthFunc(realm string, validate func(user, password string) (*Principal, error)) RouterHandler {
+	if realm == "" {
+		realm = "Authorization Required"
+	}
+	c := challenge("Basic", realm) + `, charset="UTF-8"`
+	registerAuthChallenge(c)
+	return func(ctx *Context) {
+		user, password, ok := ctx.Request.BasicAuth()
+		if ok == false {
+			authFail(ctx, c, (&AuthError{}).New(http.StatusUnauthorized, c, "authorization required"))
+			return
+		}
+		p, err := validate(user, password)
+		if err != nil {
+			authFail(ctx, c, err)
+			return
+		}
+		if p == nil {
+			authFail(ctx, c, (&AuthError{}).New(http.StatusUnauthorized, c, "invalid user name or password"))
+			return
+		}
+		p.Scheme = "Basic"
+		ctx.SetPrincipal(p)
+		ctx.Next()
+	}
+}
+
+// APIKeyConfig api key auth config
+type APIKeyConfig struct {
+	Header string            // header name to read the key from, default is "X-API-Key"
+	Query  string            // query parameter to read the key from when the header is empty, disabled if empty
+	Keys   map[string]string // static keys, maps key to the principal id
+	// Validate is used when Keys is nil, it returns nil principal for an unknown key, or an error to respond.
+	Validate func(key string) (*Principal, error)
+}
+
+// APIKeyAuth returns a middleware that authenticates requests with an api key from a header or a query parameter.
+func APIKeyAuth(cfg APIKeyConfig) RouterHandler {
+	if cfg.Header == "" {
+		cfg.Header = "X-API-Key"
+	}
+	assert1(cfg.Keys != nil || cfg.Validate != nil, "api key auth needs Keys or Validate")
+	c := challenge("ApiKey", cfg.Header)
+	registerAuthChallenge(c)
+	validate := cfg.Validate
+	if cfg.Keys != nil {
+		validate = func(key string) (*Principal, error) {
+			var found *Principal
+			// Walk all keys so the response time does not depend on which key matches.
+			for k, id := range cfg.Keys {
+				if secureCompare(key, k) && found == nil {
+					found = &Principal{ID: id}
+				}
+			}
+			return found, nil
+		}
+	}
+	return func(ctx *Context) {
+		key := ctx.Request.Header.Get(cfg.Header)
+		if key == "" && cfg.Query != "" {
+			key = ctx.Request.URL.Query().Get(cfg.Query)
+		}
+		if key == "" {
+			authFail(ctx, c, (&AuthError{}).New(http.StatusUnauthorized, c, "api key required"))
+			return
+		}
+		p, err := validate(key)
+		if err != nil {
+			authFail(ctx, c, err)
+			return
+		}
+		if p == nil {
+			authFail(ctx, c, (&AuthError{}).New(http.StatusUnauthorized, c, "invalid api key"))
+			return
+		}
+		p.Scheme = "ApiKey"
+		ctx.SetPrincipal(p)
+		ctx.Next()
+	}
+}
+
+// SessionAuth returns a middleware that requires a session loaded by the session middleware, see SessionInit.
+// idKey is the session key holding the principal id, rolesKey holds comma separated roles, both may be empty.
+func SessionAuth(idKey string, rolesKey string) RouterHandler {
+	registerAuthChallenge(challenge("Session", httpCookie.Name))
+	return func(ctx *Context) {
+		c := challenge("Session", httpCookie.Name)
+		store := ctx.GetSession()
+		if store == nil {
+			authFail(ctx, c, (&AuthError{}).New(http.StatusUnauthorized, c, "session required"))
+			return
+		}
+		p := &Principal{ID: ctx.GetSid(), Scheme: "Session"}
+		if idKey != "" {
+			p.ID = store.Get(idKey)
+			if p.ID == "" {
+				authFail(ctx, c, (&AuthError{}).New(http.StatusUnauthorized, c, fmt.Sprintf("session has no %s", idKey)))
+				return
+			}
+		}
+		if rolesKey != "" {
+			for _, r := range strings.Split(store.Get(rolesKey), ",") {
+				if r = strings.TrimSpace(r); r != "" {
+					p.Roles = append(p.Roles, r)
+				}
+			}
+		}
+		ctx.SetPrincipal(p)
+		ctx.Next()
+	}
+}
@@ -0,0 +1,215 @@
+package core
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func signJWT(t *testing.T, alg, kid string, key interface{}, claims map[string]interface{}) string {
+	h, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	c, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	hash := sha256.Sum256([]byte(signed))
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		sig, _ = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, hash[:])
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, hash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = make([]byte, 64)
+		rb, sb := r.Bytes(), s.Bytes()
+		copy(sig[32-len(rb):32], rb)
+		copy(sig[64-len(sb):], sb)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func authEngine(auth RouterHandler) *Engine {
+	engine := create()
+	engine.GET("/me", auth, func(c *Context) {
+		p := c.Principal()
+		c.Ok(p.Scheme + ":" + p.ID)
+	})
+	return engine
+}
+
+func getWithHeader(engine *Engine, key, value string) (int, string, string) {
+	r, _ := http.NewRequest("GET", "/me", nil)
+	if key != "" {
+		r.Header.Set(key, value)
+	}
+	w := performRequest(engine, r)
+	return w.Code, w.Header().Get("WWW-Authenticate"), w.Body.String()
+}
+
+func TestJWTAuthHS256(t *testing.T) {
+	secret := []byte("secret")
+	engine := authEngine(JWTAuth(JWTConfig{Secret: secret, Issuer: "core", Audience: "api", Leeway: time.Minute}))
+	now := time.Now().Unix()
+
+	tests := []struct {
+		claims map[string]interface{}
+		key    []byte
+		code   int
+	}{
+		{map[string]interface{}{"sub": "42", "iss": "core", "aud": "api", "exp": now + 60, "roles": []string{"admin"}}, secret, http.StatusOK},
+		{map[string]interface{}{"sub": "42", "iss": "core", "aud": []string{"web", "api"}, "exp": now - 30}, secret, http.StatusOK},
+		{map[string]interface{}{"sub": "42", "iss": "core", "aud": "api", "exp": now - 120}, secret, http.StatusUnauthorized},
+		{map[string]interface{}{"sub": "42", "iss": "other", "aud": "api"}, secret, http.StatusUnauthorized},
+		{map[string]interface{}{"sub": "42", "iss": "core", "aud": "web"}, secret, http.StatusUnauthorized},
+		{map[string]interface{}{"sub": "42", "iss": "core", "aud": "api"}, []byte("wrong"), http.StatusUnauthorized},
+	}
+	for i, tt := range tests {
+		code, challenge, body := getWithHeader(engine, "Authorization", "Bearer "+signJWT(t, "HS256", "", tt.key, tt.claims))
+		if code != tt.code {
+			t.Errorf("#%d status code: want %d, got %d (%s)", i, tt.code, code, body)
+		}
+		if code == http.StatusUnauthorized && strings.Contains(challenge, `error="invalid_token"`) == false {
+			t.Errorf("#%d challenge: got %q", i, challenge)
+		}
+		if code == http.StatusOK && strings.Contains(body, `"Bearer:42"`) == false {
+			t.Errorf("#%d body: got %q", i, body)
+		}
+	}
+
+	if code, challenge, _ := getWithHeader(engine, "", ""); code != http.StatusUnauthorized || challenge != `Bearer realm="api"` {
+		t.Errorf("no token: got %d %q", code, challenge)
+	}
+}
+
+func TestJWTAuthJWKS(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	set, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(ecKey.X.Bytes()), "y": b64(ecKey.Y.Bytes())},
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": b64([]byte("unsupported"))},
+		{"kty": "EC", "kid": "p384", "crv": "P-384", "x": b64(ecKey.X.Bytes()), "y": b64(ecKey.Y.Bytes())},
+	}})
+	dir, _ := ioutil.TempDir("", "jwks")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "jwks.json")
+	ioutil.WriteFile(file, set, 0600)
+
+	engine := authEngine(JWTAuth(JWTConfig{JWKSFile: file, Scopes: []string{"orders:read"}}))
+	claims := map[string]interface{}{"sub": "7", "scope": "orders:read orders:write"}
+
+	if code, _, body := getWithHeader(engine, "Authorization", "Bearer "+signJWT(t, "RS256", "rsa", rsaKey, claims)); code != http.StatusOK {
+		t.Errorf("RS256: want %d, got %d (%s)", http.StatusOK, code, body)
+	}
+	if code, _, body := getWithHeader(engine, "Authorization", "Bearer "+signJWT(t, "ES256", "ec", ecKey, claims)); code != http.StatusOK {
+		t.Errorf("ES256: want %d, got %d (%s)", http.StatusOK, code, body)
+	}
+	// The RSA public key must not be usable as an HMAC secret.
+	forged := signJWT(t, "HS256", "rsa", rsaKey.N.Bytes(), claims)
+	if code, _, _ := getWithHeader(engine, "Authorization", "Bearer "+forged); code != http.StatusUnauthorized {
+		t.Errorf("alg confusion: want %d, got %d", http.StatusUnauthorized, code)
+	}
+	token := signJWT(t, "RS256", "rsa", rsaKey, map[string]interface{}{"sub": "7", "scope": "orders:write"})
+	code, challenge, _ := getWithHeader(engine, "Authorization", "Bearer "+token)
+	if code != http.StatusForbidden || strings.Contains(challenge, `error="insufficient_scope"`) == false {
+		t.Errorf("scope: got %d %q", code, challenge)
+	}
+}
+
+func TestJWKSFetchOnce(t *testing.T) {
+	var fetches int32
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		w.Write([]byte(`{"keys":[{"kty":"oct","kid":"k1","k":"c2VjcmV0"}]}`))
+	}))
+	defer ts.Close()
+	ks := &jwks{url: ts.URL, refresh: time.Hour, keys: map[string]interface{}{}}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 5)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = ks.get("k1")
+		}(i)
+	}
+	for atomic.LoadInt32(&fetches) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if fetches != 1 {
+		t.Errorf("want 1 fetch, got %d", fetches)
+	}
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("request %d: %v", i, err)
+		}
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	engine := authEngine(BasicAuth("admin", map[string]string{"foo": "bar"}))
+
+	r, _ := http.NewRequest("GET", "/me", nil)
+	r.SetBasicAuth("foo", "bar")
+	if w := performRequest(engine, r); w.Code != http.StatusOK || strings.Contains(w.Body.String(), `"Basic:foo"`) == false {
+		t.Errorf("valid: got %d %q", w.Code, w.Body.String())
+	}
+
+	r.SetBasicAuth("foo", "baz")
+	w := performRequest(engine, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("invalid: want %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if challenge := w.Header().Get("WWW-Authenticate"); challenge != `Basic realm="admin", charset="UTF-8"` {
+		t.Errorf("challenge: got %q", challenge)
+	}
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	engine := authEngine(APIKeyAuth(APIKeyConfig{Query: "api_key", Keys: map[string]string{"k1": "svc"}}))
+
+	if code, _, body := getWithHeader(engine, "X-API-Key", "k1"); code != http.StatusOK || strings.Contains(body, `"ApiKey:svc"`) == false {
+		t.Errorf("header: got %d %q", code, body)
+	}
+	r, _ := http.NewRequest("GET", "/me?api_key=k1", nil)
+	if w := performRequest(engine, r); w.Code != http.StatusOK {
+		t.Errorf("query: want %d, got %d", http.StatusOK, w.Code)
+	}
+	if code, _, _ := getWithHeader(engine, "X-API-Key", "k2"); code != http.StatusUnauthorized {
+		t.Errorf("unknown key: want %d, got %d", http.StatusUnauthorized, code)
+	}
+}
+
+func TestSessionAuth(t *testing.T) {
+	if code, _, _ := getWithHeader(authEngine(SessionAuth("", "")), "", ""); code != http.StatusUnauthorized {
+		t.Errorf("no session: want %d, got %d", http.StatusUnauthorized, code)
+	}
+}
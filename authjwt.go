@@ -0,0 +1,403 @@
+package core
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// JWTConfig jwt bearer token auth config
+type JWTConfig struct {
+	Realm       string        // realm of the WWW-Authenticate header
+	Secret      []byte        // HS256 shared secret
+	JWKSFile    string        // path of a JSON Web Key Set file holding RS256/ES256/HS256 keys
+	JWKSURL     string        // url of a JSON Web Key Set, refreshed every JWKSRefresh
+	JWKSRefresh time.Duration // default is 1 hour
+	Algorithms  []string      // allowed algorithms, default is all of HS256, RS256 and ES256 that have keys
+	Leeway      time.Duration // clock skew allowed when checking exp, nbf and iat
+	Audience    string        // required aud claim, not checked if empty
+	Issuer      string        // required iss claim, not checked if empty
+	Scopes      []string      // scopes required in the scope or scp claim, missing scopes respond 403
+	RolesClaim  string        // claim holding the principal roles, default is "roles"
+	Query       string        // query parameter to read the token from when there is no Authorization header
+}
+
+// jwtHeader jose header
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+var errTokenInvalid = errors.New("token is invalid")
+
+// JWTAuth returns a middleware that authenticates requests with a JWT bearer token.
+// It panics if the JWKS file can not be loaded.
+func JWTAuth(cfg JWTConfig) RouterHandler {
+	if cfg.Realm == "" {
+		cfg.Realm = "api"
+	}
+	if cfg.RolesClaim == "" {
+		cfg.RolesClaim = "roles"
+	}
+	keys := &jwks{url: cfg.JWKSURL, refresh: cfg.JWKSRefresh, keys: map[string]interface{}{}}
+	if keys.refresh == 0 {
+		keys.refresh = time.Hour
+	}
+	if cfg.Secret != nil {
+		keys.keys[""] = cfg.Secret
+	}
+	if cfg.JWKSFile != "" {
+		b, err := ioutil.ReadFile(cfg.JWKSFile)
+		if err != nil {
+			panic(err)
+		}
+		if err = keys.parse(b); err != nil {
+			panic(fmt.Sprintf("jwks file %s: %s", cfg.JWKSFile, err))
+		}
+	}
+	assert1(len(keys.keys) > 0 || keys.url != "", "jwt auth needs Secret, JWKSFile or JWKSURL")
+	registerAuthChallenge(challenge("Bearer", cfg.Realm))
+
+	return func(ctx *Context) {
+		token := ""
+		if auth := ctx.Request.Header.Get("Authorization"); auth != "" {
+			if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+				token = strings.TrimSpace(auth[7:])
+			}
+		} else if cfg.Query != "" {
+			token = ctx.Request.URL.Query().Get(cfg.Query)
+		}
+		if token == "" {
+			c := challenge("Bearer", cfg.Realm)
+			authFail(ctx, c, (&AuthError{}).New(http.StatusUnauthorized, c, "bearer token required"))
+			return
+		}
+		claims, err := cfg.verify(keys, token)
+		if err != nil {
+			c := challenge("Bearer", cfg.Realm, "error", "invalid_token", "error_description", err.Error())
+			authFail(ctx, c, (&AuthError{}).New(http.StatusUnauthorized, c, err.Error()))
+			return
+		}
+		if missing := missingScopes(claims, cfg.Scopes); len(missing) > 0 {
+			c := challenge("Bearer", cfg.Realm, "error", "insufficient_scope", "scope", strings.Join(cfg.Scopes, " "))
+			authFail(ctx, c, (&AuthError{}).New(http.StatusForbidden, c, "insufficient scope: "+strings.Join(missing, " ")))
+			return
+		}
+		p := &Principal{Scheme: "Bearer", Claims: claims}
+		p.ID, _ = claims["sub"].(string)
+		p.Roles = stringsClaim(claims[cfg.RolesClaim])
+		ctx.SetPrincipal(p)
+		ctx.Next()
+	}
+}
+
+// verify checks the token signature and its registered claims, and returns the claims.
+func (cfg *JWTConfig) verify(keys *jwks, token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("token is malformed")
+	}
+	var header jwtHeader
+	if err := jwtDecode(parts[0], &header); err != nil {
+		return nil, errors.New("token header is malformed")
+	}
+	if cfg.Algorithms != nil && inStrings(cfg.Algorithms, header.Alg) == false {
+		return nil, fmt.Errorf("token algorithm %s is not allowed", header.Alg)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("token signature is malformed")
+	}
+	key, err := keys.get(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err = jwtVerifySignature(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err = jwtDecode(parts[1], &claims); err != nil {
+		return nil, errors.New("token claims are malformed")
+	}
+	now := time.Now()
+	if exp, ok := claims["exp"].(float64); ok && now.After(unixTime(exp).Add(cfg.Leeway)) {
+		return nil, errors.New("token is expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(cfg.Leeway).Before(unixTime(nbf)) {
+		return nil, errors.New("token is not valid yet")
+	}
+	if iat, ok := claims["iat"].(float64); ok && now.Add(cfg.Leeway).Before(unixTime(iat)) {
+		return nil, errors.New("token is issued in the future")
+	}
+	if cfg.Issuer != "" && claims["iss"] != cfg.Issuer {
+		return nil, errors.New("token issuer is invalid")
+	}
+	if cfg.Audience != "" && inStrings(stringsClaim(claims["aud"]), cfg.Audience) == false {
+		return nil, errors.New("token audience is invalid")
+	}
+	return claims, nil
+}
+
+// jwtVerifySignature verifies sig of signed with key, the key type must match the algorithm.
+func jwtVerifySignature(alg string, key interface{}, signed string, sig []byte) error {
+	hash := sha256.Sum256([]byte(signed))
+	switch alg {
+	case "HS256":
+		secret, ok := key.([]byte)
+		if ok == false {
+			return errTokenInvalid
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signed))
+		if hmac.Equal(mac.Sum(nil), sig) == false {
+			return errors.New("token signature is invalid")
+		}
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		if ok == false {
+			return errTokenInvalid
+		}
+		if rsa.VerifyPKCS1v15(pub, crypto.SHA256, hash[:], sig) != nil {
+			return errors.New("token signature is invalid")
+		}
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if ok == false || len(sig) != 64 {
+			return errTokenInvalid
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		if ecdsa.Verify(pub, hash[:], r, s) == false {
+			return errors.New("token signature is invalid")
+		}
+	default:
+		return fmt.Errorf("token algorithm %s is not supported", alg)
+	}
+	return nil
+}
+
+func jwtDecode(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func unixTime(f float64) time.Time {
+	return time.Unix(int64(f), 0)
+}
+
+// stringsClaim reads a claim which is a string or an array of strings.
+func stringsClaim(v interface{}) []string {
+	switch c := v.(type) {
+	case string:
+		return []string{c}
+	case []interface{}:
+		a := make([]string, 0, len(c))
+		for _, s := range c {
+			if str, ok := s.(string); ok {
+				a = append(a, str)
+			}
+		}
+		return a
+	}
+	return nil
+}
+
+func missingScopes(claims map[string]interface{}, required []string) []string {
+	var granted []string
+	if scope, ok := claims["scope"].(string); ok {
+		granted = strings.Fields(scope)
+	} else {
+		granted = stringsClaim(claims["scp"])
+	}
+	var missing []string
+	for _, s := range required {
+		if inStrings(granted, s) == false {
+			missing = append(missing, s)
+		}
+	}
+	return missing
+}
+
+func inStrings(a []string, s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// jwks is a JSON Web Key Set, keys are indexed by kid, "" is the default key.
+type jwks struct {
+	sync.RWMutex
+	url     string
+	refresh time.Duration
+	fetched time.Time
+	keys    map[string]interface{}
+	flights flightGroup // the concurrent requests wait for the fetch in flight
+}
+
+// jwk JSON Web Key
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// get returns the key of kid, the key set is fetched again if it is stale or kid is unknown.
+func (ks *jwks) get(kid string) (interface{}, error) {
+	ks.RLock()
+	key, ok := ks.keys[kid]
+	if ok == false && kid != "" && len(ks.keys) == 1 {
+		key, ok = ks.keys[""]
+	}
+	stale := ks.url != "" && time.Since(ks.fetched) > ks.refresh
+	// Do not fetch more than once a minute for unknown kids.
+	retry := ks.url != "" && ok == false && time.Since(ks.fetched) > time.Minute
+	ks.RUnlock()
+	if ok == true && stale == false {
+		return key, nil
+	}
+	if stale == true || retry == true {
+		if err := ks.fetchOnce(); err != nil {
+			if ok == true {
+				return key, nil
+			}
+			return nil, errors.New("token key is unavailable")
+		}
+		ks.RLock()
+		key, ok = ks.keys[kid]
+		ks.RUnlock()
+	}
+	if ok == false {
+		return nil, errors.New("token key is unknown")
+	}
+	return key, nil
+}
+
+// fetchOnce fetches the key set, the concurrent callers wait for the fetch in flight and get its error.
+func (ks *jwks) fetchOnce() error {
+	call, leader := ks.flights.join("")
+	if leader == false {
+		<-call.done
+		err, _ := call.value.(error)
+		return err
+	}
+	err := ks.fetch()
+	if err != nil {
+		log.WithFields(log.Fields{"url": ks.url, "err": err}).Warnln("fetch jwks failed")
+	}
+	ks.flights.leave("", call, err)
+	return err
+}
+
+func (ks *jwks) fetch() error {
+	// Mark when done, failed or not, so that a failing url is not fetched again before the retry delay.
+	defer func() {
+		ks.Lock()
+		ks.fetched = time.Now()
+		ks.Unlock()
+	}()
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(ks.url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return ks.parse(b)
+}
+
+// parse replaces the keys with the JSON Web Key Set in b, the keys of an unsupported type or curve are skipped.
+func (ks *jwks) parse(b []byte) error {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return err
+	}
+	keys := map[string]interface{}{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			log.WithFields(log.Fields{"kid": k.Kid, "kty": k.Kty, "err": err}).Warnln("skip jwk")
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	ks.Lock()
+	if secret, ok := ks.keys[""].([]byte); ok {
+		if _, ok := keys[""]; ok == false {
+			keys[""] = secret
+		}
+	}
+	ks.keys = keys
+	ks.Unlock()
+	return nil
+}
+
+func (k *jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("curve %s is not supported", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "oct":
+		return base64.RawURLEncoding.DecodeString(k.K)
+	}
+	return nil, fmt.Errorf("key type %s is not supported", k.Kty)
+}
@@ -0,0 +1,309 @@
+package core
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// AuthzRequest is what the policy has to decide on.
+type AuthzRequest struct {
+	Ctx         *Context
+	Principal   *Principal
+	Roles       []string // the principal must have one of the roles
+	Permissions []string // the principal must have all the permissions
+}
+
+// IPolicy authorization policy engine interface
+type IPolicy interface {
+	// Authorize returns whether the request is allowed, and the reason of the decision for audit.
+	Authorize(req *AuthzRequest) (bool, string)
+}
+
+// PolicyFunc is a callback policy.
+type PolicyFunc func(req *AuthzRequest) (bool, string)
+
+// Authorize calls f.
+func (f PolicyFunc) Authorize(req *AuthzRequest) (bool, string) {
+	return f(req)
+}
+
+// Policy is a RBAC policy with ABAC rules, it can be built in code or loaded from a file with LoadPolicy.
+//
+// Roles maps a role to its permissions, "*" and "orders:*" wildcards are supported.
+// Rules are evaluated after the roles: a matching deny rule always denies, a matching allow rule grants its actions.
+type Policy struct {
+	Roles map[string][]string `json:"roles" yaml:"roles"`
+	Rules []PolicyRule        `json:"rules" yaml:"rules"`
+}
+
+// PolicyRule is an ABAC rule.
+//
+// When maps attributes to expected values, all of them must match. Attributes are
+// method, path, principal.id, principal.scheme, principal.claims.<name>, param.<name>, query.<name> and header.<name>.
+// A value of the form ${attribute} is compared to another attribute, e.g. {"param.id": "${principal.id}"}.
+type PolicyRule struct {
+	Effect  string            `json:"effect" yaml:"effect"` // allow or deny
+	Actions []string          `json:"actions" yaml:"actions"`
+	Roles   []string          `json:"roles" yaml:"roles"` // the rule only applies to these roles if not empty
+	When    map[string]string `json:"when" yaml:"when"`
+}
+
+var (
+	// authzPolicy is the policy used by Require and Allow, default is an empty Policy which only checks roles.
+	authzPolicy IPolicy = &Policy{}
+	authzMutex  sync.RWMutex
+
+	// policyDecoders maps a policy file extension to its decoder.
+	policyDecoders = map[string]func([]byte, interface{}) error{
+		".json": jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal,
+	}
+
+	// AuthChallenge is the WWW-Authenticate header of the 401 responded by RequireRole and Allow to the requests without principal.
+	// Default is the challenges of the auth middlewares created, or a Bearer challenge if there are none.
+	AuthChallenge string
+
+	authChallengesMu sync.Mutex
+	authChallenges   []string // challenges of the auth middlewares created, see AuthChallenge
+)
+
+// SetPolicy sets the policy used by Require and Allow.
+func SetPolicy(p IPolicy) {
+	authzMutex.Lock()
+	authzPolicy = p
+	authzMutex.Unlock()
+}
+
+// RegisterPolicyDecoder registers a decoder of policy files by extension, e.g. RegisterPolicyDecoder(".yaml", yaml.Unmarshal).
+func RegisterPolicyDecoder(ext string, decode func([]byte, interface{}) error) {
+	policyDecoders[ext] = decode
+}
+
+// LoadPolicy loads a Policy from a JSON file, or from a file of a format registered with RegisterPolicyDecoder.
+func LoadPolicy(file string) (*Policy, error) {
+	decode, ok := policyDecoders[strings.ToLower(filepath.Ext(file))]
+	if ok == false {
+		return nil, fmt.Errorf("policy file %s: no decoder registered for %s", file, filepath.Ext(file))
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	p := &Policy{}
+	if err = decode(b, p); err != nil {
+		return nil, fmt.Errorf("policy file %s: %s", file, err)
+	}
+	for _, r := range p.Rules {
+		if r.Effect != "allow" && r.Effect != "deny" {
+			return nil, fmt.Errorf("policy file %s: invalid rule effect %q", file, r.Effect)
+		}
+	}
+	return p, nil
+}
+
+// Authorize implements IPolicy.
+func (p *Policy) Authorize(req *AuthzRequest) (bool, string) {
+	if len(req.Roles) > 0 {
+		ok := false
+		for _, r := range req.Roles {
+			if req.Principal.HasRole(r) {
+				ok = true
+				break
+			}
+		}
+		if ok == false {
+			return false, "missing role " + strings.Join(req.Roles, "|")
+		}
+	}
+	for _, perm := range req.Permissions {
+		if allowed, reason := p.permit(req, perm); allowed == false {
+			return false, reason
+		}
+	}
+	return true, "granted"
+}
+
+// permit decides on a single permission.
+func (p *Policy) permit(req *AuthzRequest, perm string) (bool, string) {
+	granted := ""
+	for _, role := range req.Principal.Roles {
+		for _, g := range p.Roles[role] {
+			if matchAction(g, perm) {
+				granted = "role " + role
+			}
+		}
+	}
+	for i, r := range p.Rules {
+		if r.applies(req, perm) == false {
+			continue
+		}
+		if r.Effect == "deny" {
+			return false, fmt.Sprintf("%s denied by rule %d", perm, i)
+		}
+		if granted == "" {
+			granted = fmt.Sprintf("rule %d", i)
+		}
+	}
+	if granted == "" {
+		return false, "missing permission " + perm
+	}
+	return true, perm + " granted by " + granted
+}
+
+func (r *PolicyRule) applies(req *AuthzRequest, perm string) bool {
+	ok := false
+	for _, a := range r.Actions {
+		if matchAction(a, perm) {
+			ok = true
+			break
+		}
+	}
+	if ok == false {
+		return false
+	}
+	if len(r.Roles) > 0 {
+		ok = false
+		for _, role := range r.Roles {
+			if req.Principal.HasRole(role) {
+				ok = true
+				break
+			}
+		}
+		if ok == false {
+			return false
+		}
+	}
+	for attr, want := range r.When {
+		if strings.HasPrefix(want, "${") && strings.HasSuffix(want, "}") {
+			want = attribute(req, want[2:len(want)-1])
+			if want == "" {
+				return false
+			}
+		}
+		if attribute(req, attr) != want {
+			return false
+		}
+	}
+	return true
+}
+
+// attribute resolves an ABAC attribute of the request.
+func attribute(req *AuthzRequest, name string) string {
+	ctx := req.Ctx
+	switch {
+	case name == "method":
+		return ctx.Request.Method
+	case name == "path":
+		return ctx.Request.URL.Path
+	case name == "principal.id":
+		return req.Principal.ID
+	case name == "principal.scheme":
+		return req.Principal.Scheme
+	case strings.HasPrefix(name, "principal.claims."):
+		if v, ok := req.Principal.Claims[name[17:]]; ok {
+			return fmt.Sprint(v)
+		}
+	case strings.HasPrefix(name, "param."):
+		return ctx.Param(name[6:])
+	case strings.HasPrefix(name, "query."):
+		return ctx.Request.URL.Query().Get(name[6:])
+	case strings.HasPrefix(name, "header."):
+		return ctx.Request.Header.Get(name[7:])
+	}
+	return ""
+}
+
+// matchAction matches an action against a pattern, "*" matches all actions and "orders:*" all actions starting with "orders:".
+func matchAction(pattern, action string) bool {
+	if pattern == "*" || pattern == action {
+		return true
+	}
+	return strings.HasSuffix(pattern, "*") && strings.HasPrefix(action, pattern[:len(pattern)-1])
+}
+
+// registerAuthChallenge adds the challenge of an auth middleware to the default AuthChallenge.
+func registerAuthChallenge(c string) {
+	authChallengesMu.Lock()
+	defer authChallengesMu.Unlock()
+	for _, known := range authChallenges {
+		if known == c {
+			return
+		}
+	}
+	authChallenges = append(authChallenges, c)
+}
+
+// authChallenge returns the WWW-Authenticate header of the requests without principal, see AuthChallenge.
+func authChallenge() string {
+	if AuthChallenge != "" {
+		return AuthChallenge
+	}
+	authChallengesMu.Lock()
+	defer authChallengesMu.Unlock()
+	if len(authChallenges) == 0 {
+		return challenge("Bearer", "Authorization Required")
+	}
+	return strings.Join(authChallenges, ", ")
+}
+
+// authorize returns a middleware asking the policy for the roles and permissions.
+func authorize(roles []string, permissions []string) RouterHandler {
+	return func(ctx *Context) {
+		p := ctx.Principal()
+		if p == nil {
+			ctx.Fail((&AuthError{}).New(http.StatusUnauthorized, authChallenge(), "authorization required"))
+			return
+		}
+		authzMutex.RLock()
+		policy := authzPolicy
+		authzMutex.RUnlock()
+
+		allowed, reason := policy.Authorize(&AuthzRequest{Ctx: ctx, Principal: p, Roles: roles, Permissions: permissions})
+		if allowed && log.IsLevelEnabled(log.DebugLevel) == false {
+			ctx.Next()
+			return
+		}
+		fields := log.Fields{
+			"path":      ctx.Request.URL.Path,
+			"method":    ctx.Request.Method,
+			"principal": p.ID,
+			"scheme":    p.Scheme,
+			"allowed":   allowed,
+			"reason":    reason,
+		}
+		if allowed == false {
+			log.WithFields(fields).Warnln("authorization denied")
+			ctx.Fail((&ForbiddenError{}).New("permission denied"))
+			return
+		}
+		log.WithFields(fields).Debugln("authorization granted")
+		ctx.Next()
+	}
+}
+
+// RequireRole returns a middleware that requires the principal to have one of the roles.
+func RequireRole(roles ...string) RouterHandler {
+	return authorize(roles, nil)
+}
+
+// Allow returns a middleware that requires the principal to have all the permissions, e.g. GET(path, Allow("orders:read"), handler).
+func Allow(permissions ...string) RouterHandler {
+	return authorize(nil, permissions)
+}
+
+// Require adds a middleware to the group requiring the principal to have one of the roles.
+func (group *RouterGroup) Require(roles ...string) IRoutes {
+	return group.Use(RequireRole(roles...))
+}
+
+// Allow adds a middleware to the group requiring the principal to have all the permissions.
+func (group *RouterGroup) Allow(permissions ...string) IRoutes {
+	return group.Use(Allow(permissions...))
+}
@@ -0,0 +1,131 @@
+package core
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// principalAs returns a middleware authenticating every request as a principal with the id and roles.
+func principalAs(id string, roles ...string) RouterHandler {
+	return func(c *Context) {
+		c.SetPrincipal(&Principal{ID: id, Roles: roles})
+		c.Next()
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	engine := create()
+	admin := engine.Group("/admin", principalAs("1", "admin"))
+	admin.Require("admin")
+	admin.GET("/ok", func(c *Context) { c.Ok(nil) })
+	user := engine.Group("/user", principalAs("2", "user"))
+	user.Require("admin")
+	user.GET("/ok", func(c *Context) { c.Ok(nil) })
+	engine.GET("/anonymous", RequireRole("admin"), func(c *Context) { c.Ok(nil) })
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/admin/ok", http.StatusOK},
+		{"/user/ok", http.StatusForbidden},
+		{"/anonymous", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		r, _ := http.NewRequest("GET", tt.path, nil)
+		if w := performRequest(engine, r); w.Code != tt.code {
+			t.Errorf("%s: want %d, got %d", tt.path, tt.code, w.Code)
+		} else if tt.code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") != authChallenge() {
+			t.Errorf("%s: want challenge %q, got %q", tt.path, authChallenge(), w.Header().Get("WWW-Authenticate"))
+		}
+	}
+}
+
+func TestAuthChallenge(t *testing.T) {
+	defer func(challenges []string) { authChallenges = challenges }(authChallenges)
+	authChallenges = nil
+
+	if c := authChallenge(); c != `Bearer realm="Authorization Required"` {
+		t.Errorf("no auth: want a Bearer challenge, got %q", c)
+	}
+	BasicAuth("admin", map[string]string{"root": "secret"})
+	APIKeyAuth(APIKeyConfig{Keys: map[string]string{"k": "svc"}})
+	BasicAuth("admin", map[string]string{"root": "secret"})
+	if c := authChallenge(); c != `Basic realm="admin", charset="UTF-8", ApiKey realm="X-API-Key"` {
+		t.Errorf("want the challenges of the auth middlewares, got %q", c)
+	}
+	defer func() { AuthChallenge = "" }()
+	AuthChallenge = `Bearer realm="custom"`
+	if c := authChallenge(); c != AuthChallenge {
+		t.Errorf("want AuthChallenge, got %q", c)
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "policy")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "policy.json")
+	ioutil.WriteFile(file, []byte(`{
+		"roles": {"admin": ["*"], "clerk": ["orders:*"]},
+		"rules": [
+			{"effect": "deny", "actions": ["orders:delete"], "roles": ["clerk"]},
+			{"effect": "allow", "actions": ["users:read"], "when": {"param.id": "${principal.id}"}}
+		]
+	}`), 0600)
+	policy, err := LoadPolicy(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(dir, "policy.conf")
+	ioutil.WriteFile(other, []byte("admin *\nclerk orders:*"), 0600)
+	if _, err = LoadPolicy(other); err == nil {
+		t.Error("conf: want an error without decoder")
+	}
+	RegisterPolicyDecoder(".conf", func(b []byte, v interface{}) error {
+		p := v.(*Policy)
+		p.Roles = map[string][]string{}
+		for _, line := range strings.Split(string(b), "\n") {
+			f := strings.Fields(line)
+			p.Roles[f[0]] = f[1:]
+		}
+		return nil
+	})
+	defer delete(policyDecoders, ".conf")
+	confPolicy, err := LoadPolicy(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reflect.DeepEqual(policy.Roles, confPolicy.Roles) == false {
+		t.Errorf("conf: want %+v, got %+v", policy.Roles, confPolicy.Roles)
+	}
+	SetPolicy(policy)
+	defer SetPolicy(&Policy{})
+
+	engine := create()
+	engine.GET("/admin/orders/:id", principalAs("1", "admin"), Allow("orders:delete"), func(c *Context) { c.Ok(nil) })
+	engine.GET("/clerk/orders/:id", principalAs("2", "clerk"), Allow("orders:read"), func(c *Context) { c.Ok(nil) })
+	engine.DELETE("/clerk/orders/:id", principalAs("2", "clerk"), Allow("orders:delete"), func(c *Context) { c.Ok(nil) })
+	engine.GET("/users/:id", principalAs("3"), Allow("users:read"), func(c *Context) { c.Ok(nil) })
+
+	tests := []struct {
+		method, path string
+		code         int
+	}{
+		{"GET", "/admin/orders/1", http.StatusOK},
+		{"GET", "/clerk/orders/1", http.StatusOK},
+		{"DELETE", "/clerk/orders/1", http.StatusForbidden},
+		{"GET", "/users/3", http.StatusOK},
+		{"GET", "/users/4", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		r, _ := http.NewRequest(tt.method, tt.path, nil)
+		if w := performRequest(engine, r); w.Code != tt.code {
+			t.Errorf("%s %s: want %d, got %d", tt.method, tt.path, tt.code, w.Code)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package core
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+)
+
+// bodyTooLargeMessage is the message of the PayloadTooLargeError of the request body.
+const bodyTooLargeMessage = "Request Entity Too Large"
+
+// limitedBody limits the size of the request body, see MaxBodyBytes and BodyLimit.
+type limitedBody struct {
+	io.ReadCloser
+	read, max     int64 // no limit if max <= 0
+	contentLength int64
+	err           error
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	if b.max <= 0 {
+		n, err := b.ReadCloser.Read(p)
+		b.read += int64(n)
+		return n, err
+	}
+	if b.contentLength > b.max {
+		b.err = (&PayloadTooLargeError{}).New(bodyTooLargeMessage)
+		return 0, b.err
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	// Read one more byte to tell if the limit is exceeded.
+	if int64(len(p))-1 > b.max-b.read {
+		p = p[:b.max-b.read+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) <= b.max-b.read {
+		b.read += int64(n)
+		return n, err
+	}
+	n = int(b.max - b.read)
+	b.read = b.max
+	b.err = (&PayloadTooLargeError{}).New(bodyTooLargeMessage)
+	return n, b.err
+}
+
+// setBodyLimit changes the limit of the request body, if it has not been read beyond yet.
+func (ctx *Context) setBodyLimit(max int64) {
+	if ctx.body != nil && ctx.body.err == nil {
+		ctx.body.max = max
+	}
+}
+
+// BodyLimit returns a middleware limiting the request body of the route to max bytes, instead of MaxBodyBytes.
+// Requests whose Content-Length exceeds the limit are rejected at once.
+// A max of 0 removes the limit of the route, e.g. for large uploads, a negative max panics.
+func BodyLimit(max int64) RouterHandler {
+	assert1(max >= 0, "body limit can not be negative")
+	return func(ctx *Context) {
+		if max > 0 && ctx.Request.ContentLength > max {
+			ctx.Fail((&PayloadTooLargeError{}).New(bodyTooLargeMessage))
+			return
+		}
+		ctx.setBodyLimit(max)
+		ctx.Next()
+	}
+}
+
+// BufferBody returns a middleware reading the request body at once, so that Body and the request body
+// can be read by all the next handlers.
+func BufferBody() RouterHandler {
+	return func(ctx *Context) {
+		if _, err := ctx.Body(); err != nil {
+			ctx.Fail(err)
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// Body returns the request body, within the body limit.
+// The body is kept, and the request body is reset so that it can be read again by the next handlers.
+// Use BufferBody when a handler reads the request body itself before Body is called.
+func (ctx *Context) Body() ([]byte, error) {
+	if ctx.bodyBuf == nil {
+		if ctx.Request.Body == nil {
+			return nil, nil
+		}
+		b, err := ioutil.ReadAll(ctx.Request.Body)
+		if err != nil {
+			if _, ok := err.(ICoreError); ok == false {
+				err = (&ValidationError{}).New("invalid body: " + err.Error())
+			}
+			return nil, err
+		}
+		if b == nil {
+			b = []byte{}
+		}
+		ctx.bodyBuf = b
+	}
+	closer := io.Closer(ctx.Request.Body)
+	if ctx.body != nil {
+		closer = ctx.body
+	}
+	ctx.Request.Body = struct {
+		io.Reader
+		io.Closer
+	}{bytes.NewReader(ctx.bodyBuf), closer}
+	return ctx.bodyBuf, nil
+}
+
+// bodyTooLarge tells if err is the PayloadTooLargeError of the request body, or was caused by it.
+// The readers wrapping the body, like the multipart reader, do not keep the error, the body keeps it.
+func (ctx *Context) bodyTooLarge(err error) bool {
+	if _, ok := err.(*PayloadTooLargeError); ok {
+		return true
+	}
+	if ctx.body == nil {
+		return false
+	}
+	_, ok := ctx.body.err.(*PayloadTooLargeError)
+	return ok
+}
@@ -0,0 +1,130 @@
+package core
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestBodyLimit(t *testing.T) {
+	engine := create()
+	engine.POST("/small", BodyLimit(8), func(c *Context) {
+		b, err := c.Body()
+		if err != nil {
+			c.Fail(err)
+			return
+		}
+		c.Ok(string(b))
+	})
+
+	tests := []struct {
+		body          string
+		contentLength int64
+		code          int
+	}{
+		{"12345678", 8, http.StatusOK},
+		{"123456789", 9, http.StatusRequestEntityTooLarge},
+		{"123456789", -1, http.StatusRequestEntityTooLarge}, // chunked, the limit applies while reading
+		{"12345678", -1, http.StatusOK},
+	}
+	for _, tt := range tests {
+		r, _ := http.NewRequest("POST", "/small", strings.NewReader(tt.body))
+		r.ContentLength = tt.contentLength
+		w := performRequest(engine, r)
+		if w.Code != tt.code {
+			t.Errorf("%q (%d): want %d, got %d %s", tt.body, tt.contentLength, tt.code, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestMaxBodyBytes(t *testing.T) {
+	defer func(max int64) { MaxBodyBytes = max }(MaxBodyBytes)
+	MaxBodyBytes = 4
+	engine := create()
+	handler := func(c *Context) {
+		if _, err := c.Body(); err != nil {
+			c.Fail(err)
+			return
+		}
+		c.Ok(nil)
+	}
+	engine.POST("/global", handler)
+	engine.POST("/route", BodyLimit(16), handler)
+
+	r, _ := http.NewRequest("POST", "/global", strings.NewReader("12345"))
+	w := performRequest(engine, r)
+	if w.Code != http.StatusRequestEntityTooLarge || strings.Contains(w.Body.String(), bodyTooLargeMessage) == false {
+		t.Errorf("global: want 413, got %d %s", w.Code, w.Body.String())
+	}
+	r, _ = http.NewRequest("POST", "/route", strings.NewReader("12345"))
+	if w = performRequest(engine, r); w.Code != http.StatusOK {
+		t.Errorf("route: want 200, got %d %s", w.Code, w.Body.String())
+	}
+	engine.POST("/unlimited", BodyLimit(0), handler)
+	r, _ = http.NewRequest("POST", "/unlimited", strings.NewReader(strings.Repeat("1", 64)))
+	if w = performRequest(engine, r); w.Code != http.StatusOK {
+		t.Errorf("unlimited: want 200, got %d %s", w.Code, w.Body.String())
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("negative: want panic")
+			}
+		}()
+		BodyLimit(-1)
+	}()
+}
+
+func TestGetBodyJSONTooLarge(t *testing.T) {
+	defer func(max int64) { MaxBodyBytes = max }(MaxBodyBytes)
+	MaxBodyBytes = 4
+	engine := create()
+	engine.POST("/context", func(c *Context) {
+		c.GetBodyJSON()
+		if c.Written() == false {
+			c.Ok(c.BodyJSON)
+		}
+	})
+	engine.POST("/controller", func(c *Context) {
+		c.Ok((&Controller{}).GetBodyJSON(c))
+	})
+
+	for _, path := range []string{"/context", "/controller"} {
+		r, _ := http.NewRequest("POST", path, strings.NewReader(`{"name":"core"}`))
+		r.Header.Set("Content-Type", "application/json")
+		if w := performRequest(engine, r); w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s: want 413, got %d %s", path, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestBufferBody(t *testing.T) {
+	engine := create()
+	var signed, logged string
+	sign := func(c *Context) {
+		b, _ := ioutil.ReadAll(c.Request.Body)
+		signed = string(b)
+		c.Next()
+	}
+	logBody := func(c *Context) {
+		b, _ := c.Body()
+		logged = string(b)
+		c.Next()
+	}
+	engine.POST("/echo", BufferBody(), sign, logBody, Typed(func(c *Context, in *struct {
+		Name string `json:"name"`
+	}) (string, error) {
+		return in.Name, nil
+	}))
+
+	body := `{"name":"core"}`
+	r, _ := http.NewRequest("POST", "/echo", strings.NewReader(body))
+	w := performRequest(engine, r)
+	if signed != body || logged != body {
+		t.Errorf("want body read by each middleware, got %q and %q", signed, logged)
+	}
+	if strings.Contains(w.Body.String(), `"data":"core"`) == false {
+		t.Errorf("want body bound, got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,411 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// CacheConfig configures the Cache middleware.
+type CacheConfig struct {
+	Store   CacheStore                  // default is DefaultCacheStore
+	Query   []string                    // query params of the key, all of them if nil
+	Headers []string                    // request headers of the key
+	Session bool                        // the key has the session id, so the private responses of a session are cached by session
+	Tags    func(ctx *Context) []string // tags of the responses, see InvalidateCache and Context.CacheTags
+	MaxSize int                         // larger responses are not cached, default is 1MB
+}
+
+// DefaultCacheStore is the store of the Cache middlewares without store, an in-memory LRU of 10000 responses and 64MB.
+var DefaultCacheStore CacheStore = NewMemoryCache(10000, 64<<20)
+
+var (
+	cacheStoresMu sync.Mutex
+	cacheStores   []CacheStore // stores of the Cache middlewares, invalidated by InvalidateCache
+)
+
+// cachedResponse is a response stored by Cache.
+type cachedResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+	Stored time.Time
+	Vary   map[string]string // request headers named by the Vary header of the response
+}
+
+// Cache returns a middleware caching the successful GET responses for ttl, keyed by method, path, query and selected headers:
+//
+//	router.GET("/articles/:id", core.Cache(time.Minute, core.CacheConfig{Query: []string{}, Tags: func(ctx *core.Context) []string {
+//		return []string{"article:" + ctx.Param("id")}
+//	}}), getArticle)
+//
+//	// in the service updating an article:
+//	core.InvalidateCache("article:" + id)
+//
+// The request Cache-Control no-store bypasses the cache and no-cache refreshes it. The responses having a Set-Cookie,
+// a Vary: * or a Cache-Control no-store, private (unless keyed by user) or no-cache are not cached, a shorter max-age shortens the ttl.
+// The responses to a principal or to a request having an Authorization or a Cookie header are keyed by user, never shared.
+// The cached responses are revalidated with their ETag and Last-Modified, and the concurrent misses of a key wait for the first one.
+func Cache(ttl time.Duration, cfg ...CacheConfig) RouterHandler {
+	var c CacheConfig
+	if len(cfg) > 0 {
+		c = cfg[0]
+	}
+	if c.Store == nil {
+		c.Store = DefaultCacheStore
+	}
+	if c.MaxSize <= 0 {
+		c.MaxSize = 1 << 20
+	}
+	registerCacheStore(c.Store)
+	flights := &flightGroup{}
+
+	return func(ctx *Context) {
+		r := ctx.Request
+		reqCC := parseCacheControl(r.Header.Get("Cache-Control"))
+		if r.Method != "GET" && r.Method != "HEAD" || hasKey(reqCC, "no-store") {
+			ctx.Next()
+			return
+		}
+		key, byUser := c.key(ctx)
+		refresh := hasKey(reqCC, "no-cache") || reqCC["max-age"] == "0"
+		if refresh == false {
+			if res := c.load(key, r); res != nil {
+				res.serve(ctx)
+				return
+			}
+		}
+
+		call, leader := flights.join(key)
+		if leader == false {
+			select {
+			case <-call.done:
+				if res, _ := call.value.(*cachedResponse); res != nil && res.matches(r) {
+					res.serve(ctx)
+					return
+				}
+			case <-r.Context().Done():
+				return
+			}
+			ctx.Next()
+			return
+		}
+		var res *cachedResponse
+		defer func() { flights.leave(key, call, res) }()
+
+		h := ctx.ResponseWriter.Header()
+		h.Set("X-Cache", "MISS")
+		// Only the Cache-Control set by the handlers tells if the response can be cached, not the default one.
+		defaultCC := h.Get("Cache-Control")
+		h.Del("Cache-Control")
+		var cw *cacheWriter
+		restore := ctx.WrapWriter(func(w http.ResponseWriter) http.ResponseWriter {
+			cw = &cacheWriter{ResponseWriter: w, max: c.MaxSize, defaultCC: defaultCC}
+			return cw
+		})
+		ctx.Next()
+		restore()
+		if cw.status == 0 && h.Get("Cache-Control") == "" && defaultCC != "" {
+			h.Set("Cache-Control", defaultCC)
+		}
+		res = c.store(ctx, key, byUser, ttl, cw)
+	}
+}
+
+// CacheTags adds tags to the response cached by Cache, see InvalidateCache.
+func (ctx *Context) CacheTags(tags ...string) {
+	prev, _ := ctx.Data["core.cache.tags"].([]string)
+	ctx.Data["core.cache.tags"] = append(prev, tags...)
+}
+
+// InvalidateCache removes the responses cached with any of the tags from the stores of the Cache middlewares.
+func InvalidateCache(tags ...string) error {
+	cacheStoresMu.Lock()
+	stores := append([]CacheStore{}, cacheStores...)
+	cacheStoresMu.Unlock()
+	var err error
+	for _, s := range stores {
+		if e := s.Invalidate(tags...); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func registerCacheStore(s CacheStore) {
+	cacheStoresMu.Lock()
+	defer cacheStoresMu.Unlock()
+	for _, known := range cacheStores {
+		if known == s {
+			return
+		}
+	}
+	cacheStores = append(cacheStores, s)
+}
+
+// key returns the cache key of the request, HEAD requests share the key of GET.
+// The requests of a principal, of a session or having an Authorization or a Cookie header are keyed by user,
+// byUser is true if the key has the user.
+func (c *CacheConfig) key(ctx *Context) (key string, byUser bool) {
+	r := ctx.Request
+	query := r.URL.Query()
+	if c.Query != nil {
+		selected := url.Values{}
+		for _, name := range c.Query {
+			if v, ok := query[name]; ok {
+				selected[name] = v
+			}
+		}
+		query = selected
+	}
+	var b strings.Builder
+	b.WriteString("GET " + r.Host + r.URL.Path + "?" + query.Encode())
+	for _, name := range c.Headers {
+		b.WriteString("|" + strings.ToLower(name) + "=" + r.Header.Get(name))
+	}
+	if c.Session {
+		if sid, _ := ctx.Data["Sid"].(string); sid != "" {
+			b.WriteString("|sid=" + sid)
+			byUser = true
+		}
+	}
+	if p := ctx.Principal(); p != nil {
+		b.WriteString("|principal=" + strconv.Itoa(len(p.Scheme)) + ":" + p.Scheme + p.ID)
+		byUser = true
+	} else if auth := r.Header.Get("Authorization"); auth != "" {
+		sum := sha256.Sum256([]byte(auth))
+		b.WriteString("|auth=" + hex.EncodeToString(sum[:]))
+		byUser = true
+	} else if cookie := r.Header.Get("Cookie"); cookie != "" && byUser == false {
+		// The cookies may authenticate the request in a middleware running after Cache.
+		sum := sha256.Sum256([]byte(cookie))
+		b.WriteString("|cookie=" + hex.EncodeToString(sum[:]))
+		byUser = true
+	}
+	return b.String(), byUser
+}
+
+// load returns the response cached under key if it matches the request.
+func (c *CacheConfig) load(key string, r *http.Request) *cachedResponse {
+	b, err := c.Store.Get(key)
+	if err != nil {
+		log.WithFields(log.Fields{"key": key, "err": err}).Warnln("read cache failed")
+		return nil
+	}
+	if b == nil {
+		return nil
+	}
+	res := &cachedResponse{}
+	if err = json.Unmarshal(b, res); err != nil || res.matches(r) == false {
+		return nil
+	}
+	return res
+}
+
+// store caches the response recorded by cw if it is cacheable.
+func (c *CacheConfig) store(ctx *Context, key string, byUser bool, ttl time.Duration, cw *cacheWriter) *cachedResponse {
+	h := ctx.ResponseWriter.Header()
+	if cw.status != http.StatusOK || cw.skip || ctx.Request.Method == "HEAD" || h.Get("Set-Cookie") != "" {
+		return nil
+	}
+	cc := parseCacheControl(cw.cc)
+	if hasKey(cc, "no-store") || hasKey(cc, "no-cache") || hasKey(cc, "private") && byUser == false {
+		return nil
+	}
+	if maxAge, err := strconv.Atoi(cc["max-age"]); err == nil {
+		if d := time.Duration(maxAge) * time.Second; d < ttl {
+			ttl = d
+		}
+	}
+	if ttl <= 0 {
+		return nil
+	}
+	res := &cachedResponse{Status: cw.status, Header: http.Header{}, Body: cw.buf.Bytes(), Stored: time.Now()}
+	for k, v := range h {
+		if k != "X-Cache" {
+			res.Header[k] = append([]string{}, v...)
+		}
+	}
+	if cw.cc == "" {
+		res.Header.Del("Cache-Control")
+	}
+	for _, name := range headerTokens(h, "Vary") {
+		if name == "*" {
+			return nil
+		}
+		if res.Vary == nil {
+			res.Vary = make(map[string]string)
+		}
+		res.Vary[http.CanonicalHeaderKey(name)] = ctx.Request.Header.Get(name)
+	}
+	var tags []string
+	if c.Tags != nil {
+		tags = c.Tags(ctx)
+	}
+	if more, ok := ctx.Data["core.cache.tags"].([]string); ok {
+		tags = append(tags, more...)
+	}
+	b, err := json.Marshal(res)
+	if err == nil {
+		err = c.Store.Set(key, b, ttl, tags)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"key": key, "err": err}).Warnln("write cache failed")
+		return nil
+	}
+	return res
+}
+
+// matches tells if the request has the values of the Vary headers of the response.
+func (res *cachedResponse) matches(r *http.Request) bool {
+	for name, v := range res.Vary {
+		if r.Header.Get(name) != v {
+			return false
+		}
+	}
+	return true
+}
+
+// serve responds the cached response, or 304 Not Modified if the request validators match.
+func (res *cachedResponse) serve(ctx *Context) {
+	h := ctx.ResponseWriter.Header()
+	for k, v := range res.Header {
+		h[k] = v
+	}
+	h.Set("Age", strconv.Itoa(int(time.Since(res.Stored)/time.Second)))
+	h.Set("X-Cache", "HIT")
+	if res.notModified(ctx.Request) {
+		h.Del("Content-Type")
+		h.Del("Content-Length")
+		ctx.ResponseWriter.WriteHeader(http.StatusNotModified)
+		return
+	}
+	h.Set("Content-Length", strconv.Itoa(len(res.Body)))
+	ctx.ResponseWriter.WriteHeader(res.Status)
+	if ctx.Request.Method != "HEAD" {
+		ctx.ResponseWriter.Write(res.Body)
+	}
+}
+
+// notModified tells if the If-None-Match or If-Modified-Since header of the request matches the response.
+func (res *cachedResponse) notModified(r *http.Request) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		etag := strings.TrimPrefix(res.Header.Get("ETag"), "W/")
+		if etag == "" {
+			return false
+		}
+		for _, tag := range strings.Split(inm, ",") {
+			if tag = strings.TrimSpace(tag); tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(res.Header.Get("Last-Modified"))
+	return err == nil && modified.After(ims) == false
+}
+
+// parseCacheControl returns the directives of a Cache-Control header, by lower case name.
+func parseCacheControl(header string) map[string]string {
+	cc := make(map[string]string)
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		name, value := strings.ToLower(strings.TrimSpace(kv[0])), ""
+		if len(kv) == 2 {
+			value = strings.Trim(strings.TrimSpace(kv[1]), `"`)
+		}
+		cc[name] = value
+	}
+	return cc
+}
+
+func hasKey(m map[string]string, key string) bool {
+	_, ok := m[key]
+	return ok
+}
+
+// cacheWriter records the response written to the client, up to max bytes.
+type cacheWriter struct {
+	http.ResponseWriter
+	status    int
+	buf       bytes.Buffer
+	max       int
+	skip      bool   // the response is not cacheable
+	cc        string // Cache-Control set by the handlers
+	defaultCC string // Cache-Control sent if the handlers set none
+}
+
+func (w *cacheWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.writeHeader(code)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *cacheWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.writeHeader(http.StatusOK)
+	}
+	if w.skip == false {
+		if w.buf.Len()+len(p) > w.max {
+			w.skip = true
+			w.buf = bytes.Buffer{}
+		} else {
+			w.buf.Write(p)
+		}
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// writeHeader records the status and the Cache-Control of the handlers, and restores the default one if they set none.
+func (w *cacheWriter) writeHeader(code int) {
+	w.status = code
+	h := w.Header()
+	w.cc = h.Get("Cache-Control")
+	if w.cc == "" && w.defaultCC != "" {
+		h.Set("Cache-Control", w.defaultCC)
+	}
+}
+
+// Flush flushes the response, streamed responses are not cached.
+func (w *cacheWriter) Flush() {
+	w.skip = true
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack hands over the connection, the response is not cached.
+func (w *cacheWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if ok == false {
+		return nil, nil, errors.New("the response writer does not support hijacking")
+	}
+	w.skip = true
+	return h.Hijack()
+}
+
+// Unwrap returns the underlying writer.
+func (w *cacheWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
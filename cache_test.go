@@ -0,0 +1,216 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	var calls int32
+	engine := create()
+	engine.GET("/items/:id", Cache(time.Minute, CacheConfig{
+		Store: NewMemoryCache(10, 0),
+		Query: []string{"page"},
+		Tags:  func(c *Context) []string { return []string{"item:" + c.Param("id")} },
+	}), func(c *Context) {
+		n := atomic.AddInt32(&calls, 1)
+		h := c.ResponseWriter.Header()
+		h.Set("ETag", `"v`+strconv.Itoa(int(n))+`"`)
+		h.Set("Vary", "Accept-Language")
+		if c.Request.URL.Query().Get("private") != "" {
+			h.Set("Cache-Control", "private")
+		}
+		c.Ok(int(n))
+	})
+
+	get := func(url string, header ...string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("GET", url, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		return performRequest(engine, r)
+	}
+	tests := []struct {
+		name   string
+		url    string
+		header []string
+		code   int
+		xcache string
+		calls  int32
+	}{
+		{"miss", "/items/1?page=1&utm=a", nil, 200, "MISS", 1},
+		{"hit", "/items/1?page=1&utm=b", nil, 200, "HIT", 1},
+		{"other page", "/items/1?page=2", nil, 200, "MISS", 2},
+		{"conditional", "/items/1?page=1", []string{"If-None-Match", `"v1"`}, 304, "HIT", 2},
+		{"vary", "/items/1?page=1", []string{"Accept-Language", "fr"}, 200, "MISS", 3},
+		{"refresh", "/items/1?page=1", []string{"Accept-Language", "fr", "Cache-Control", "no-cache"}, 200, "MISS", 4},
+		{"no-store", "/items/1?page=1", []string{"Accept-Language", "fr", "Cache-Control", "no-store"}, 200, "", 5},
+		{"private", "/items/2?private=1", nil, 200, "MISS", 6},
+		{"private not cached", "/items/2?private=1", nil, 200, "MISS", 7},
+	}
+	for _, tt := range tests {
+		w := get(tt.url, tt.header...)
+		if w.Code != tt.code || w.Header().Get("X-Cache") != tt.xcache || atomic.LoadInt32(&calls) != tt.calls {
+			t.Errorf("%s: want %d %q after %d calls, got %d %q after %d calls", tt.name, tt.code, tt.xcache, tt.calls, w.Code, w.Header().Get("X-Cache"), atomic.LoadInt32(&calls))
+		}
+		atomic.StoreInt32(&calls, tt.calls)
+	}
+
+	if w := get("/items/1?page=1", "Accept-Language", "fr"); w.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("want cached, got %q", w.Header().Get("X-Cache"))
+	}
+	if err := InvalidateCache("item:1"); err != nil {
+		t.Fatal(err)
+	}
+	if w := get("/items/1?page=1", "Accept-Language", "fr"); w.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("want invalidated, got %q", w.Header().Get("X-Cache"))
+	}
+}
+
+func TestCacheByUser(t *testing.T) {
+	var calls int32
+	engine := create()
+	me := func(c *Context) {
+		atomic.AddInt32(&calls, 1)
+		c.Ok(c.Request.Header.Get("Authorization") + c.Request.Header.Get("Cookie"))
+	}
+	engine.GET("/me", Cache(time.Minute, CacheConfig{Store: NewMemoryCache(10, 0)}), me)
+	engine.GET("/principal", func(c *Context) {
+		c.SetPrincipal(&Principal{ID: c.Request.Header.Get("Authorization"), Scheme: "Bearer"})
+		c.Next()
+	}, Cache(time.Minute, CacheConfig{Store: NewMemoryCache(10, 0)}), me)
+	// The session cookie is read by a middleware running after Cache.
+	engine.GET("/cookie", Cache(time.Minute, CacheConfig{Store: NewMemoryCache(10, 0)}), func(c *Context) {
+		c.Data["Sid"] = c.Request.Header.Get("Cookie")
+		c.Next()
+	}, me)
+
+	tests := []struct {
+		path   string
+		header string
+		prefix string
+	}{
+		{"/me", "Authorization", "Bearer "},
+		{"/principal", "Authorization", "Bearer "},
+		{"/cookie", "Cookie", "sid="},
+	}
+	for _, tt := range tests {
+		atomic.StoreInt32(&calls, 0)
+		get := func(user string) *httptest.ResponseRecorder {
+			r, _ := http.NewRequest("GET", tt.path, nil)
+			r.Header.Set(tt.header, tt.prefix+user)
+			return performRequest(engine, r)
+		}
+		get("alice")
+		w := get("bob")
+		if w.Header().Get("X-Cache") != "MISS" || strings.Contains(w.Body.String(), "alice") {
+			t.Errorf("%s: want bob not served the response of alice, got %q %s", tt.path, w.Header().Get("X-Cache"), w.Body.String())
+		}
+		if w = get("alice"); w.Header().Get("X-Cache") != "HIT" || strings.Contains(w.Body.String(), "alice") == false {
+			t.Errorf("%s: want alice served her cached response, got %q %s", tt.path, w.Header().Get("X-Cache"), w.Body.String())
+		}
+		if calls != 2 {
+			t.Errorf("%s: want 2 calls, got %d", tt.path, calls)
+		}
+	}
+}
+
+func TestCacheSessionPrivate(t *testing.T) {
+	var calls int32
+	engine := create()
+	engine.GET("/account", func(c *Context) {
+		if sid := c.Request.URL.Query().Get("sid"); sid != "" {
+			c.Data["Sid"] = sid
+		}
+		c.Next()
+	}, Cache(time.Minute, CacheConfig{Store: NewMemoryCache(10, 0), Query: []string{}, Session: true}), func(c *Context) {
+		n := atomic.AddInt32(&calls, 1)
+		c.ResponseWriter.Header().Set("Cache-Control", "private")
+		c.Ok(int(n))
+	})
+
+	tests := []struct {
+		url    string
+		xcache string
+		calls  int32
+	}{
+		{"/account?sid=a", "MISS", 1},
+		{"/account?sid=a", "HIT", 1},
+		{"/account", "MISS", 2},
+		{"/account", "MISS", 3},
+	}
+	for _, tt := range tests {
+		r, _ := http.NewRequest("GET", tt.url, nil)
+		w := performRequest(engine, r)
+		if w.Header().Get("X-Cache") != tt.xcache || atomic.LoadInt32(&calls) != tt.calls {
+			t.Errorf("%s: want %q after %d calls, got %q after %d calls", tt.url, tt.xcache, tt.calls, w.Header().Get("X-Cache"), atomic.LoadInt32(&calls))
+		}
+	}
+}
+
+func TestCacheSingleflight(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	engine := create()
+	engine.GET("/slow", Cache(time.Minute, CacheConfig{Store: NewMemoryCache(10, 0)}), func(c *Context) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		c.CacheTags("slow")
+		c.Ok("done")
+	})
+
+	var wg sync.WaitGroup
+	codes := make([]int, 5)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r, _ := http.NewRequest("GET", "/slow", nil)
+			codes[i] = performRequest(engine, r).Code
+		}(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if calls != 1 {
+		t.Errorf("want 1 call, got %d", calls)
+	}
+	for i, code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("request %d: want 200, got %d", i, code)
+		}
+	}
+}
+
+func TestMemoryCache(t *testing.T) {
+	s := NewMemoryCache(2, 0)
+	s.Set("a", []byte("1"), time.Minute, []string{"t"})
+	s.Set("b", []byte("2"), time.Minute, nil)
+	s.Get("a")
+	s.Set("c", []byte("3"), time.Minute, []string{"t"})
+	if b, _ := s.Get("b"); b != nil {
+		t.Errorf("want least recently used evicted, got %q", b)
+	}
+	s.Set("d", []byte("4"), -time.Second, nil)
+	if b, _ := s.Get("d"); b != nil {
+		t.Errorf("want expired, got %q", b)
+	}
+	s.Invalidate("t")
+	if s.Len() != 0 {
+		t.Errorf("want tagged entries invalidated, got %d entries", s.Len())
+	}
+
+	s = NewMemoryCache(0, 10)
+	s.Set("a", []byte("12345"), time.Minute, nil)
+	s.Set("b", []byte("12345"), time.Minute, nil)
+	s.Set("c", []byte("123"), time.Minute, nil)
+	if b, _ := s.Get("a"); b != nil || s.Size() != 8 {
+		t.Errorf("want least recently used evicted beyond 10 bytes, got %q and %d bytes", b, s.Size())
+	}
+}
@@ -0,0 +1,234 @@
+package core
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/HiLittleCat/conn"
+	redis "gopkg.in/redis.v5"
+)
+
+// CacheStore stores the responses cached by Cache.
+type CacheStore interface {
+	// Get returns the value stored under key, nil if it is missing or expired.
+	Get(key string) ([]byte, error)
+	// Set stores the value under key for ttl, the key is invalidated with any of the tags.
+	Set(key string, value []byte, ttl time.Duration, tags []string) error
+	// Invalidate removes the keys stored with any of the tags.
+	Invalidate(tags ...string) error
+}
+
+// MemoryCache is an in-memory LRU CacheStore.
+type MemoryCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int64
+	bytes      int64                    // size of the values
+	lru        *list.List               // most recently used first
+	entries    map[string]*list.Element // elements by key
+	tags       map[string]map[string]struct{}
+}
+
+type memoryCacheEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+	tags    []string
+}
+
+// NewMemoryCache returns a MemoryCache keeping at most maxEntries values of maxBytes in total,
+// the least recently used are evicted beyond. There is no limit if zero.
+func NewMemoryCache(maxEntries int, maxBytes int64) *MemoryCache {
+	return &MemoryCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		lru:        list.New(),
+		entries:    make(map[string]*list.Element),
+		tags:       make(map[string]map[string]struct{}),
+	}
+}
+
+// Get returns the value of key.
+func (s *MemoryCache) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.entries[key]
+	if ok == false {
+		return nil, nil
+	}
+	e := el.Value.(*memoryCacheEntry)
+	if time.Now().After(e.expires) {
+		s.remove(el)
+		return nil, nil
+	}
+	s.lru.MoveToFront(el)
+	return e.value, nil
+}
+
+// Set stores the value of key.
+func (s *MemoryCache) Set(key string, value []byte, ttl time.Duration, tags []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.entries[key]; ok {
+		s.remove(el)
+	}
+	e := &memoryCacheEntry{key: key, value: value, expires: time.Now().Add(ttl), tags: tags}
+	s.entries[key] = s.lru.PushFront(e)
+	s.bytes += int64(len(value))
+	for _, tag := range tags {
+		if s.tags[tag] == nil {
+			s.tags[tag] = make(map[string]struct{})
+		}
+		s.tags[tag][key] = struct{}{}
+	}
+	for s.maxEntries > 0 && s.lru.Len() > s.maxEntries || s.maxBytes > 0 && s.bytes > s.maxBytes {
+		s.remove(s.lru.Back())
+	}
+	return nil
+}
+
+// Invalidate removes the keys of the tags.
+func (s *MemoryCache) Invalidate(tags ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, tag := range tags {
+		for key := range s.tags[tag] {
+			if el, ok := s.entries[key]; ok {
+				s.remove(el)
+			}
+		}
+		delete(s.tags, tag)
+	}
+	return nil
+}
+
+// Size returns the size of the values, expired ones included.
+func (s *MemoryCache) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bytes
+}
+
+// Len returns the number of entries, expired ones included.
+func (s *MemoryCache) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lru.Len()
+}
+
+func (s *MemoryCache) remove(el *list.Element) {
+	e := s.lru.Remove(el).(*memoryCacheEntry)
+	delete(s.entries, e.key)
+	s.bytes -= int64(len(e.value))
+	for _, tag := range e.tags {
+		if keys := s.tags[tag]; keys != nil {
+			delete(keys, e.key)
+			if len(keys) == 0 {
+				delete(s.tags, tag)
+			}
+		}
+	}
+}
+
+// RedisCache is a CacheStore shared by the servers through redis, the keys of a tag are kept in a redis set.
+type RedisCache struct {
+	pool   *conn.RedisPool
+	prefix string
+}
+
+// NewRedisCache returns a RedisCache storing the keys under prefix, e.g. "cache:".
+func NewRedisCache(pool *conn.RedisPool, prefix string) *RedisCache {
+	return &RedisCache{pool: pool, prefix: prefix}
+}
+
+// Get returns the value of key.
+func (s *RedisCache) Get(key string) ([]byte, error) {
+	var b []byte
+	var err error
+	s.pool.Exec(func(c *redis.Client) {
+		b, err = c.Get(s.prefix + key).Bytes()
+	})
+	if err == redis.Nil {
+		return nil, nil
+	}
+	return b, err
+}
+
+// Set stores the value of key, the sets of the tags live as long as their longest key.
+func (s *RedisCache) Set(key string, value []byte, ttl time.Duration, tags []string) error {
+	var err error
+	s.pool.Exec(func(c *redis.Client) {
+		if err = c.Set(s.prefix+key, value, ttl).Err(); err != nil {
+			return
+		}
+		for _, tag := range tags {
+			tagKey := s.prefix + "tag:" + tag
+			if err = c.SAdd(tagKey, key).Err(); err != nil {
+				return
+			}
+			if d, _ := c.TTL(tagKey).Result(); d < ttl {
+				if err = c.Expire(tagKey, ttl).Err(); err != nil {
+					return
+				}
+			}
+		}
+	})
+	return err
+}
+
+// Invalidate removes the keys of the tags.
+func (s *RedisCache) Invalidate(tags ...string) error {
+	var err error
+	s.pool.Exec(func(c *redis.Client) {
+		for _, tag := range tags {
+			tagKey := s.prefix + "tag:" + tag
+			var keys []string
+			if keys, err = c.SMembers(tagKey).Result(); err != nil {
+				return
+			}
+			for i, key := range keys {
+				keys[i] = s.prefix + key
+			}
+			if err = c.Del(append(keys, tagKey)...).Err(); err != nil {
+				return
+			}
+		}
+	})
+	return err
+}
+
+// flightGroup runs one call at a time by key, the other callers wait for its result.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	done  chan struct{}
+	value interface{}
+}
+
+// join returns the call of key, and true if the caller leads it and must call leave.
+func (g *flightGroup) join(key string) (*flightCall, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if c, ok := g.calls[key]; ok {
+		return c, false
+	}
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	c := &flightCall{done: make(chan struct{})}
+	g.calls[key] = c
+	return c, true
+}
+
+// leave ends the call of key with its value, the waiting callers are released.
+func (g *flightGroup) leave(key string, c *flightCall, value interface{}) {
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	c.value = value
+	close(c.done)
+}
@@ -0,0 +1,292 @@
+package core
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Encoder is a compressing writer, *gzip.Writer and *zlib.Writer are encoders.
+type Encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// CompressConfig configures the Compress middleware.
+type CompressConfig struct {
+	MinSize int      // responses smaller than MinSize are not compressed, default is 1024
+	Types   []string // compressed content types, a type ending with "/" matches all its subtypes, default is text and the usual text based formats
+	Level   int      // compression level of the encoders, default is their default level
+}
+
+// encoders by content coding, by order of preference.
+var (
+	encoderNames     = []string{"gzip", "deflate"}
+	encoderFactories = map[string]func(w io.Writer, level int) (Encoder, error){
+		"gzip": func(w io.Writer, level int) (Encoder, error) {
+			return gzip.NewWriterLevel(w, level)
+		},
+		// The deflate content coding is the zlib format, not raw DEFLATE.
+		"deflate": func(w io.Writer, level int) (Encoder, error) {
+			return zlib.NewWriterLevel(w, level)
+		},
+	}
+	encoderPools sync.Map // pools of encoders by coding and level
+)
+
+// defaultCompressTypes are the content types compressed by default.
+var defaultCompressTypes = []string{
+	"text/",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"application/xhtml+xml",
+	"application/wasm",
+	"image/svg+xml",
+}
+
+// RegisterEncoder registers the encoder of a content coding, it is preferred to the encoders registered before.
+// The level is the CompressConfig.Level, 0 asks for the default level of the encoder. E.g. for brotli:
+//
+//	core.RegisterEncoder("br", func(w io.Writer, level int) (core.Encoder, error) {
+//		if level == 0 {
+//			level = brotli.DefaultCompression
+//		}
+//		return brotli.NewWriterLevel(w, level), nil
+//	})
+func RegisterEncoder(coding string, factory func(w io.Writer, level int) (Encoder, error)) {
+	coding = strings.ToLower(coding)
+	if _, exists := encoderFactories[coding]; exists == false {
+		encoderNames = append([]string{coding}, encoderNames...)
+	}
+	encoderFactories[coding] = factory
+}
+
+// Compress returns a middleware compressing the responses with the coding of Accept-Encoding having the best quality.
+// Range responses and the responses having a Content-Encoding are not compressed.
+// A flush compresses the pending data whatever its size, so streams stay responsive.
+func Compress(cfg ...CompressConfig) RouterHandler {
+	var c CompressConfig
+	if len(cfg) > 0 {
+		c = cfg[0]
+	}
+	if c.MinSize <= 0 {
+		c.MinSize = 1024
+	}
+	if c.Types == nil {
+		c.Types = defaultCompressTypes
+	}
+	return func(ctx *Context) {
+		h := ctx.ResponseWriter.Header()
+		if strings.Contains(h.Get("Vary"), "Accept-Encoding") == false {
+			h.Add("Vary", "Accept-Encoding")
+		}
+		coding := negotiateEncoding(ctx.Request.Header.Get("Accept-Encoding"))
+		if coding == "" || ctx.Request.Method == "HEAD" || ctx.Request.Header.Get("Range") != "" {
+			ctx.Next()
+			return
+		}
+		var cw *compressWriter
+		restore := ctx.WrapWriter(func(w http.ResponseWriter) http.ResponseWriter {
+			cw = &compressWriter{ResponseWriter: w, cfg: &c, coding: coding}
+			return cw
+		})
+		returned := false
+		defer func() {
+			// On panic, the pending data is dropped so that Recover can send the error.
+			if returned {
+				cw.finish()
+			} else {
+				cw.abort()
+			}
+			restore()
+		}()
+		ctx.Next()
+		returned = true
+	}
+}
+
+// negotiateEncoding returns the registered coding of the header with the best quality, or "" for identity.
+func negotiateEncoding(accept string) string {
+	best, bestQ := "", 0.0
+	for _, name := range encoderNames {
+		if q := acceptQ(accept, name); q > bestQ {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+// compressWriter buffers the response until MinSize is reached, then decides to compress it or not.
+type compressWriter struct {
+	http.ResponseWriter
+	cfg     *CompressConfig
+	coding  string
+	status  int
+	buf     []byte
+	decided bool
+	encoder Encoder
+	pool    *sync.Pool
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.decided {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if w.status != 0 {
+		return
+	}
+	w.status = code
+	if code < 200 || code == http.StatusNoContent || code == http.StatusNotModified || code == http.StatusPartialContent {
+		w.decide(false)
+	}
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if w.decided == false {
+		w.buf = append(w.buf, p...)
+		if len(w.buf) < w.cfg.MinSize {
+			return len(p), nil
+		}
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// decide writes the header and the pending data, compressed if compress is true and the response allows it.
+func (w *compressWriter) decide(compress bool) error {
+	w.decided = true
+	h := w.ResponseWriter.Header()
+	if compress && len(w.buf) > 0 && h.Get("Content-Type") == "" {
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+	if compress && w.compressible(h) {
+		pool := encoderPool(w.coding, w.cfg.Level)
+		e, _ := pool.Get().(Encoder)
+		if e == nil {
+			return errors.New("compress: can not create the " + w.coding + " encoder")
+		}
+		e.Reset(w.ResponseWriter)
+		w.encoder, w.pool = e, pool
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", w.coding)
+		// Strong validators are not valid for the encoded representation.
+		if etag := h.Get("ETag"); strings.HasPrefix(etag, `"`) {
+			h.Set("ETag", "W/"+etag)
+		}
+	}
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	if len(w.buf) == 0 {
+		return nil
+	}
+	buf := w.buf
+	w.buf = nil
+	var err error
+	if w.encoder != nil {
+		_, err = w.encoder.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// compressible tells if the response headers allow compressing.
+func (w *compressWriter) compressible(h http.Header) bool {
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" || w.status == http.StatusPartialContent {
+		return false
+	}
+	return matchMediaType(h.Get("Content-Type"), w.cfg.Types)
+}
+
+// Flush compresses the pending data and flushes the response.
+func (w *compressWriter) Flush() {
+	if w.decided == false {
+		w.decide(true)
+	}
+	if w.encoder != nil {
+		w.encoder.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack hands over the connection, the response is not compressed.
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if ok == false {
+		return nil, nil, errors.New("the response writer does not support hijacking")
+	}
+	w.decided = true
+	return h.Hijack()
+}
+
+// ReadFrom copies r through the encoder.
+func (w *compressWriter) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(struct{ io.Writer }{w}, r)
+}
+
+// Unwrap returns the underlying writer.
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// finish writes the pending data uncompressed if MinSize was not reached, and releases the encoder.
+func (w *compressWriter) finish() {
+	if w.decided == false && (w.status != 0 || len(w.buf) > 0) {
+		w.decide(false)
+	}
+	if w.encoder != nil {
+		w.encoder.Close()
+		w.encoder.Reset(nil)
+		w.pool.Put(w.encoder)
+		w.encoder = nil
+	}
+}
+
+// abort drops the pending data and releases the encoder without ending the compressed stream.
+func (w *compressWriter) abort() {
+	w.buf = nil
+	if w.encoder != nil {
+		w.encoder.Reset(nil)
+		w.pool.Put(w.encoder)
+		w.encoder = nil
+	}
+}
+
+func encoderPool(coding string, level int) *sync.Pool {
+	key := coding + ":" + strconv.Itoa(level)
+	if p, ok := encoderPools.Load(key); ok {
+		return p.(*sync.Pool)
+	}
+	factory := encoderFactories[coding]
+	p, _ := encoderPools.LoadOrStore(key, &sync.Pool{New: func() interface{} {
+		l := level
+		if l == 0 && (coding == "gzip" || coding == "deflate") {
+			l = gzip.DefaultCompression
+		}
+		e, err := factory(nil, l)
+		if err != nil {
+			return nil
+		}
+		return e
+	}})
+	return p.(*sync.Pool)
+}
@@ -0,0 +1,140 @@
+package core
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := map[string]string{
+		"":                          "",
+		"gzip":                      "gzip",
+		"deflate, gzip":             "gzip",
+		"gzip;q=0.5, deflate":       "deflate",
+		"*":                         "gzip",
+		"*;q=0, deflate;q=0.1":      "deflate",
+		"identity, gzip;q=0":        "",
+		"br, GZIP;q=0.8":            "gzip",
+		"gzip;q=0.001, deflate;q=0": "gzip",
+	}
+	for accept, want := range tests {
+		if got := negotiateEncoding(accept); got != want {
+			t.Errorf("%q: want %q, got %q", accept, want, got)
+		}
+	}
+}
+
+func TestCompress(t *testing.T) {
+	big := strings.Repeat("compressible ", 200)
+	engine := create()
+	engine.Use(Compress(CompressConfig{MinSize: 100}))
+	engine.GET("/big", func(c *Context) { c.Ok(big) })
+	engine.GET("/small", func(c *Context) { c.Ok("small") })
+	engine.GET("/png", func(c *Context) {
+		c.ResponseWriter.Header().Set("Content-Type", "image/png")
+		c.ResponseWriter.Write([]byte(big))
+	})
+	engine.GET("/encoded", func(c *Context) {
+		c.ResponseWriter.Header().Set("Content-Encoding", "gzip")
+		c.ResponseWriter.Write([]byte(big))
+	})
+	engine.GET("/stream", func(c *Context) {
+		c.ResponseWriter.Header().Set("Content-Type", "text/plain")
+		i := 0
+		c.Stream(func(w io.Writer) bool {
+			i++
+			w.Write([]byte("chunk;"))
+			return i < 3
+		})
+	})
+
+	tests := []struct {
+		path, accept, rng string
+		encoding          string
+		body              string
+	}{
+		{"/big", "gzip", "", "gzip", big},
+		{"/big", "deflate, gzip;q=0.5", "", "deflate", big},
+		{"/big", "", "", "", big},
+		{"/big", "gzip", "bytes=0-10", "", big},
+		{"/small", "gzip", "", "", "small"},
+		{"/png", "gzip", "", "", big},
+		{"/encoded", "gzip", "", "gzip", ""},
+		{"/stream", "gzip", "", "gzip", "chunk;chunk;chunk;"},
+	}
+	for _, tt := range tests {
+		r, _ := http.NewRequest("GET", tt.path, nil)
+		r.Header.Set("Accept-Encoding", tt.accept)
+		if tt.rng != "" {
+			r.Header.Set("Range", tt.rng)
+		}
+		w := performRequest(engine, r)
+		if got := w.Header().Get("Content-Encoding"); got != tt.encoding {
+			t.Errorf("%s %q: want encoding %q, got %q", tt.path, tt.accept, tt.encoding, got)
+			continue
+		}
+		if w.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("%s: want Vary Accept-Encoding, got %q", tt.path, w.Header()["Vary"])
+		}
+		if tt.body == "" {
+			continue
+		}
+		var body io.Reader = w.Body
+		switch {
+		case tt.path == "/encoded":
+		case tt.encoding == "gzip":
+			body, _ = gzip.NewReader(w.Body)
+		case tt.encoding == "deflate":
+			body, _ = zlib.NewReader(w.Body)
+		}
+		b, err := ioutil.ReadAll(body)
+		if err != nil || strings.Contains(string(b), tt.body) == false {
+			t.Errorf("%s %q: want body %.20q, got %.20q %v", tt.path, tt.accept, tt.body, b, err)
+		}
+	}
+}
+
+func TestCompressPanic(t *testing.T) {
+	engine := create()
+	engine.Use(Compress(CompressConfig{MinSize: 100}))
+	engine.GET("/", func(c *Context) {
+		c.ResponseWriter.Write([]byte("partial"))
+		panic("boom")
+	})
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := performRequest(engine, r)
+	if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "partial") {
+		t.Errorf("want 500 without the pending data, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestCompressFlush(t *testing.T) {
+	hs := NewHandlersStack()
+	hs.Use(Compress())
+	hs.Use(func(c *Context) {
+		sse, err := c.SSE()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sse.Close()
+		sse.Send("", "", "first")
+	})
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	hs.ServeHTTP(w, r)
+	if w.Flushed == false || w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("want flushed gzip stream, got %v %q", w.Flushed, w.Header().Get("Content-Encoding"))
+	}
+	gr, _ := gzip.NewReader(w.Body)
+	if b, _ := ioutil.ReadAll(gr); string(b) != "data: first\n\n" {
+		t.Errorf("want first event, got %q", b)
+	}
+}
@@ -0,0 +1,336 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Services is the default dependency container, used by RouterGroup.Controller and Context.Resolve.
+var Services = NewContainer()
+
+// lifetimes of the provided values
+const (
+	singleton = iota // built once
+	transient        // built on each resolve
+	scoped           // built once per request
+)
+
+// Container builds and keeps the dependencies of controllers and services.
+//
+//	core.Services.Provide(func() *sql.DB { return db })
+//	core.Services.Provide(func(db *sql.DB) (*UserService, error) { return &UserService{db: db}, nil })
+//	core.Services.Scoped(func(ctx *core.Context) *Tenant { return &Tenant{ID: ctx.Param("tenant")} })
+//
+// Constructors take their dependencies as params and return the value, and optionally an error.
+// A dependency of an interface type is resolved by the only provided type implementing it.
+// Struct pointers built by the container are injected, see Inject.
+type Container struct {
+	mu        sync.RWMutex
+	providers map[reflect.Type]*dependency
+	types     []reflect.Type // provided types in registration order
+}
+
+type dependency struct {
+	typ      reflect.Type
+	fn       reflect.Value // constructor, invalid for instances
+	lifetime int
+	mu       sync.Mutex
+	built    bool
+	value    reflect.Value
+}
+
+// resolver resolves the dependencies of a single Resolve or Inject call.
+type resolver struct {
+	c     *Container
+	ctx   *Context       // request of the scoped values, nil outside requests
+	stack []reflect.Type // types being built, to detect cycles
+}
+
+// NewContainer returns an empty container.
+func NewContainer() *Container {
+	return &Container{providers: make(map[reflect.Type]*dependency)}
+}
+
+// Provide registers a constructor whose value is built on its first resolve and then shared.
+func (c *Container) Provide(constructor interface{}) {
+	c.register(constructor, singleton)
+}
+
+// Transient registers a constructor called on each resolve.
+func (c *Container) Transient(constructor interface{}) {
+	c.register(constructor, transient)
+}
+
+// Scoped registers a constructor called once per request, it can take the *Context as a param.
+// Scoped values are only resolved by Context.Resolve.
+func (c *Container) Scoped(constructor interface{}) {
+	c.register(constructor, scoped)
+}
+
+// Instance registers a built value, it is injected at once if it is a struct pointer.
+func (c *Container) Instance(v interface{}) {
+	assert1(v != nil, "instance can not be nil")
+	value := reflect.ValueOf(v)
+	if isStructPtr(value.Type()) {
+		err := (&resolver{c: c}).inject(value)
+		assert1(err == nil, fmt.Sprintf("inject %s: %v", value.Type(), err))
+	}
+	c.add(&dependency{typ: value.Type(), lifetime: singleton, built: true, value: value})
+}
+
+func (c *Container) register(constructor interface{}, lifetime int) {
+	fn := reflect.ValueOf(constructor)
+	assert1(fn.Kind() == reflect.Func, "constructor must be a func")
+	t := fn.Type()
+	name := t.String()
+	assert1(t.NumOut() == 1 || t.NumOut() == 2 && t.Out(1) == errorType, "constructor "+name+" must return a value, and optionally an error")
+	for i := 0; i < t.NumIn(); i++ {
+		assert1(t.In(i) != contextType || lifetime == scoped, "only scoped constructors can take a *core.Context, "+name)
+	}
+	c.add(&dependency{typ: t.Out(0), fn: fn, lifetime: lifetime})
+}
+
+func (c *Container) add(p *dependency) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, exists := c.providers[p.typ]
+	assert1(exists == false, p.typ.String()+" is already provided")
+	c.providers[p.typ] = p
+	c.types = append(c.types, p.typ)
+}
+
+// lookup returns the provider of t, interfaces are looked up by implementation.
+func (c *Container) lookup(t reflect.Type) (*dependency, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if p, ok := c.providers[t]; ok {
+		return p, nil
+	}
+	if t.Kind() != reflect.Interface {
+		return nil, nil
+	}
+	var found *dependency
+	for _, pt := range c.types {
+		if pt.Implements(t) == false {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("%s is implemented by both %s and %s", t, found.typ, pt)
+		}
+		found = c.providers[pt]
+	}
+	return found, nil
+}
+
+// Resolve sets the value pointed by ptr to the dependency of its type.
+//
+//	var users *UserService
+//	err := core.Services.Resolve(&users)
+func (c *Container) Resolve(ptr interface{}) error {
+	return (&resolver{c: c}).resolveInto(ptr)
+}
+
+// Inject sets the fields of the struct pointed by obj:
+//
+//	Validate *Validation     // set if nil
+//	Users    *UserService    // set if nil and Users embeds Service, built if not provided
+//	DB       *sql.DB `inject:""`         // resolved if zero
+//	Cache    ICache  `inject:"optional"` // resolved if zero and provided
+//
+// Embedded structs are injected too.
+func (c *Container) Inject(obj interface{}) error {
+	v := reflect.ValueOf(obj)
+	if isStructPtr(v.Type()) == false {
+		return errors.New("inject needs a pointer to a struct, got " + v.Type().String())
+	}
+	return (&resolver{c: c}).inject(v)
+}
+
+// Resolve sets the value pointed by ptr to the dependency of its type in Services, scoped values are built once per request.
+func (ctx *Context) Resolve(ptr interface{}) error {
+	return (&resolver{c: Services, ctx: ctx}).resolveInto(ptr)
+}
+
+func (r *resolver) resolveInto(ptr interface{}) error {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return errors.New("resolve needs a non nil pointer")
+	}
+	value, err := r.resolve(v.Type().Elem())
+	if err != nil {
+		return err
+	}
+	v.Elem().Set(value)
+	return nil
+}
+
+func (r *resolver) resolve(t reflect.Type) (reflect.Value, error) {
+	if t == contextType {
+		if r.ctx == nil {
+			return reflect.Value{}, errors.New("*core.Context is only available to scoped constructors")
+		}
+		return reflect.ValueOf(r.ctx), nil
+	}
+	p, err := r.c.lookup(t)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	if p == nil {
+		return reflect.Value{}, errors.New(t.String() + " is not provided")
+	}
+	for _, s := range r.stack {
+		if s == p.typ {
+			return reflect.Value{}, errors.New("dependency cycle: " + r.path(p.typ))
+		}
+	}
+
+	switch p.lifetime {
+	case transient:
+		return r.build(p)
+	case scoped:
+		if r.ctx == nil {
+			return reflect.Value{}, errors.New(p.typ.String() + " is request scoped")
+		}
+		scope, _ := r.ctx.Data["core.scope"].(map[reflect.Type]reflect.Value)
+		if v, ok := scope[p.typ]; ok {
+			return v, nil
+		}
+		v, err := r.build(p)
+		if err != nil {
+			return v, err
+		}
+		if scope == nil {
+			scope = make(map[reflect.Type]reflect.Value)
+			r.ctx.Data["core.scope"] = scope
+		}
+		scope[p.typ] = v
+		return v, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.built == false {
+		// Singletons never depend on the request.
+		sr := &resolver{c: r.c, stack: r.stack}
+		v, err := sr.build(p)
+		if err != nil {
+			return v, err
+		}
+		p.value, p.built = v, true
+	}
+	return p.value, nil
+}
+
+// build calls the constructor of p with its dependencies.
+func (r *resolver) build(p *dependency) (reflect.Value, error) {
+	r.stack = append(r.stack, p.typ)
+	defer func() { r.stack = r.stack[:len(r.stack)-1] }()
+
+	t := p.fn.Type()
+	args := make([]reflect.Value, t.NumIn())
+	for i := range args {
+		arg, err := r.resolve(t.In(i))
+		if err != nil {
+			return arg, fmt.Errorf("build %s: %v", p.typ, err)
+		}
+		args[i] = arg
+	}
+	out := p.fn.Call(args)
+	if len(out) == 2 && out[1].IsNil() == false {
+		return reflect.Value{}, fmt.Errorf("build %s: %v", p.typ, out[1].Interface())
+	}
+	v := out[0]
+	if isStructPtr(v.Type()) && v.IsNil() == false {
+		if err := r.inject(v); err != nil {
+			return reflect.Value{}, fmt.Errorf("inject %s: %v", p.typ, err)
+		}
+	}
+	return v, nil
+}
+
+// inject sets the fields of the struct pointed by v, see Container.Inject.
+func (r *resolver) inject(v reflect.Value) error {
+	s := v.Elem()
+	for i := 0; i < s.NumField(); i++ {
+		f := s.Field(i)
+		ft := s.Type().Field(i)
+		tag, tagged := ft.Tag.Lookup("inject")
+		switch {
+		case f.CanSet() == false:
+			continue
+		case tagged:
+			if isZero(f) == false {
+				continue
+			}
+			value, err := r.resolve(ft.Type)
+			if err != nil {
+				p, _ := r.c.lookup(ft.Type)
+				if tag == "optional" && p == nil {
+					continue
+				}
+				return fmt.Errorf("field %s: %v", ft.Name, err)
+			}
+			f.Set(value)
+		case ft.Type == validationType:
+			if f.IsNil() {
+				f.Set(reflect.ValueOf(&Validation{}))
+			}
+		case ft.Anonymous && ft.Type.Kind() == reflect.Struct:
+			// Embedded Controller, Service...
+			if err := r.inject(f.Addr()); err != nil {
+				return err
+			}
+		case isServicePtr(ft.Type):
+			if f.IsNil() == false {
+				continue
+			}
+			if p, _ := r.c.lookup(ft.Type); p != nil {
+				value, err := r.resolve(ft.Type)
+				if err != nil {
+					return fmt.Errorf("field %s: %v", ft.Name, err)
+				}
+				f.Set(value)
+				continue
+			}
+			f.Set(reflect.New(ft.Type.Elem()))
+			if err := r.inject(f); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// path returns the types being built up to t.
+func (r *resolver) path(t reflect.Type) string {
+	names := []string{}
+	for _, s := range r.stack {
+		names = append(names, s.String())
+	}
+	return strings.Join(append(names, t.String()), " -> ")
+}
+
+var (
+	validationType = reflect.TypeOf(&Validation{})
+	serviceType    = reflect.TypeOf(Service{})
+)
+
+// isServicePtr tells if t is a pointer to a struct embedding Service.
+func isServicePtr(t reflect.Type) bool {
+	if isStructPtr(t) == false {
+		return false
+	}
+	f, ok := t.Elem().FieldByName("Service")
+	return ok && f.Anonymous && f.Type == serviceType
+}
+
+func isStructPtr(t reflect.Type) bool {
+	return t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct
+}
+
+func isZero(v reflect.Value) bool {
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
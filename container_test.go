@@ -0,0 +1,103 @@
+package core
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type greeter interface {
+	Greet() string
+}
+
+type repo struct{ name string }
+
+func (r *repo) Greet() string { return "hello " + r.name }
+
+type accountService struct {
+	Service
+	Repo  *repo   `inject:""`
+	Hello greeter `inject:"optional"`
+}
+
+type tenant struct{ id string }
+
+func TestContainer(t *testing.T) {
+	c := NewContainer()
+	built := 0
+	c.Provide(func() *repo { built++; return &repo{name: "db"} })
+	c.Transient(func(r *repo) (*accountService, error) { return &accountService{}, nil })
+
+	var s1, s2 *accountService
+	if err := c.Resolve(&s1); err != nil {
+		t.Fatal(err)
+	}
+	c.Resolve(&s2)
+	if s1 == s2 || s1.Repo != s2.Repo || built != 1 {
+		t.Errorf("want transient services sharing a singleton repo, got %p %p built %d", s1, s2, built)
+	}
+	if s1.Validate == nil || s1.Hello == nil || s1.Hello.Greet() != "hello db" {
+		t.Errorf("want Validate and Hello injected, got %+v", s1)
+	}
+
+	var g greeter
+	if err := c.Resolve(&g); err != nil || g.Greet() != "hello db" {
+		t.Errorf("want greeter resolved by implementation, got %v %v", g, err)
+	}
+	var missing *tenant
+	if err := c.Resolve(&missing); err == nil {
+		t.Error("want error for a type not provided")
+	}
+}
+
+func TestContainerErrors(t *testing.T) {
+	c := NewContainer()
+	c.Provide(func(s *accountService) *repo { return &repo{} })
+	c.Provide(func(r *repo) *accountService { return &accountService{} })
+	var r *repo
+	if err := c.Resolve(&r); err == nil || strings.Contains(err.Error(), "dependency cycle") == false {
+		t.Errorf("want dependency cycle, got %v", err)
+	}
+
+	c = NewContainer()
+	c.Provide(func() (*repo, error) { return nil, errors.New("no db") })
+	if err := c.Resolve(&r); err == nil || strings.Contains(err.Error(), "no db") == false {
+		t.Errorf("want constructor error, got %v", err)
+	}
+
+	c.Scoped(func(ctx *Context) *tenant { return &tenant{} })
+	var tn *tenant
+	if err := c.Resolve(&tn); err == nil {
+		t.Error("want error resolving a scoped value outside a request")
+	}
+}
+
+func TestContextResolve(t *testing.T) {
+	defer func(s *Container) { Services = s }(Services)
+	Services = NewContainer()
+	calls := 0
+	Services.Scoped(func(ctx *Context) *tenant { calls++; return &tenant{id: ctx.Param("tenant")} })
+
+	engine := create()
+	engine.GET("/:tenant", func(c *Context) {
+		var t1, t2 *tenant
+		c.Resolve(&t1)
+		c.Resolve(&t2)
+		if t1 != t2 {
+			c.Fail(errors.New("not the same tenant"))
+			return
+		}
+		c.Ok(t1.id)
+	})
+	for _, id := range []string{"a", "b"} {
+		r, _ := http.NewRequest("GET", "/"+id, nil)
+		w := performRequest(engine, r)
+		if strings.Contains(w.Body.String(), `"data":"`+id+`"`) == false {
+			t.Errorf("want tenant %s, got %s", id, w.Body.String())
+		}
+	}
+	if calls != 2 {
+		t.Errorf("want one tenant per request, got %d", calls)
+	}
+}
@@ -1,13 +1,15 @@
 package core
 
 import (
-	"archive/zip"
+	"bufio"
+	"bytes"
 	"crypto/md5"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"runtime"
@@ -33,6 +35,16 @@ type Context struct {
 	Params         Params                 // Path Value
 	Data           map[string]interface{} // Custom Data
 	BodyJSON       map[string]interface{} // body json data
+	body           *limitedBody           // limits the request body, see MaxBodyBytes
+	bodyBuf        []byte                 // request body kept by Body
+	status         int                    // status of the response, see Status
+	size           int64                  // bytes of the response body, see Size
+	writtenAt      time.Time              // time the response header was written, see WrittenAt
+	engine         *Engine                // engine serving the request, its error handlers are run by Fail
+	errorIndex     int                    // index of the next error handler, see Engine.OnError
+	errorID        string                 // see ErrorID
+	err            error                  // deferred error, see Error
+	streams        []*SSE                 // event streams closed when the handler returns
 }
 
 // ResFormat response data
@@ -41,6 +53,7 @@ type ResFormat struct {
 	Data    interface{} `json:"data"`
 	Message string      `json:"message"`
 	Errno   int         `json:"errno"`
+	ErrorID string      `json:"errorId,omitempty"` // id of the error for the support, see ErrorIDs
 }
 
 // Redirect Redirect replies to the request with a redirect to url, which may be a path relative to the request path.
@@ -75,6 +88,22 @@ func (ctx *Context) Fail(err error) {
 		return
 	}
 
+	// Run the error handlers not run yet, a handler calling Fail with another error passes it to the next ones.
+	if ctx.engine != nil {
+		handlers := ctx.engine.errorHandlers
+		for ctx.errorIndex < len(handlers) {
+			h := handlers[ctx.errorIndex]
+			ctx.errorIndex++
+			if h(ctx, err) || ctx.written {
+				return
+			}
+		}
+	}
+	ctx.render(err)
+}
+
+// render writes the error response of err.
+func (ctx *Context) render(err error) {
 	errno := 0
 	errCore, ok := err.(ICoreError)
 	if ok == true {
@@ -88,7 +117,14 @@ func (ctx *Context) Fail(err error) {
 	}
 
 	var json = jsoniter.ConfigCompatibleWithStandardLibrary
-	b, _ := json.Marshal(&ResFormat{Ok: false, Message: err.Error(), Errno: errno})
+	b, _ := json.Marshal(&ResFormat{Ok: false, Message: err.Error(), Errno: errno, ErrorID: ctx.errorID})
+
+	if authErr, ok := err.(*AuthError); ok == true && authErr.Challenge != "" {
+		ctx.ResponseWriter.Header().Set("WWW-Authenticate", authErr.Challenge)
+	}
+	if unavailable, ok := err.(*UnavailableError); ok == true && unavailable.RetryAfter > 0 {
+		ctx.ResponseWriter.Header().Set("Retry-After", strconv.Itoa(int((unavailable.RetryAfter+time.Second-1)/time.Second)))
+	}
 
 	coreErr, ok := err.(ICoreError)
 	if ok == true {
@@ -101,25 +137,7 @@ func (ctx *Context) Fail(err error) {
 
 //ZipHandler 响应下载文件请求，返回zip文件
 func (ctx *Context) ZipHandler(fileName string, file []byte) {
-	zipName := fileName + ".zip"
-	rw := ctx.ResponseWriter
-	// 设置header信息中的ctontent-type，对于zip可选以下两种
-	// rw.Header().Set("Content-Type", "application/octet-stream")
-	rw.Header().Set("Content-Type", "application/zip")
-	// 设置header信息中的Content-Disposition为attachment类型
-	rw.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", zipName))
-	// 向rw中写入zip文件
-	// 创建zip.Writer
-	zipW := zip.NewWriter(rw)
-	defer zipW.Close()
-
-	// 向zip中添加文件
-	f, err := zipW.Create(fileName)
-	if err != nil {
-		log.WithFields(log.Fields{"path": ctx.Request.URL.Path}).Warnln(err.Error())
-	}
-	// 向文件中写入文件内容
-	f.Write(file)
+	ctx.ZipStream(fileName+".zip", []ArchiveEntry{{Name: fileName, Reader: bytes.NewReader(file), Size: int64(len(file))}})
 }
 
 // ResFree Response json
@@ -183,10 +201,14 @@ func (ctx *Context) GetSession() IStore {
 }
 
 // GetBodyJSON return a json from body
+// The request fails if the body can not be read, e.g. with a PayloadTooLargeError, and BodyJSON is nil then.
 func (ctx *Context) GetBodyJSON() {
 	var reqJSON map[string]interface{}
-	body, _ := ioutil.ReadAll(ctx.Request.Body)
-	defer ctx.Request.Body.Close()
+	body, err := ctx.Body()
+	if err != nil {
+		ctx.Fail(err)
+		return
+	}
 	cType := ctx.Request.Header.Get("Content-Type")
 	a := strings.Split(cType, ";")
 	if a[0] == "application/x-www-form-urlencoded" {
@@ -246,6 +268,24 @@ func (ctx *Context) DeleteSession() error {
 	return nil
 }
 
+// Principal get the authenticated principal, nil if the request is anonymous
+func (ctx *Context) Principal() *Principal {
+	p := ctx.Data["principal"]
+	if p == nil {
+		return nil
+	}
+	principal, ok := p.(*Principal)
+	if ok == false {
+		return nil
+	}
+	return principal
+}
+
+// SetPrincipal set the authenticated principal
+func (ctx *Context) SetPrincipal(p *Principal) {
+	ctx.Data["principal"] = p
+}
+
 //GetSid 获取sid
 func (ctx *Context) GetSid() string {
 	sid := ctx.Data["Sid"]
@@ -264,32 +304,65 @@ func (ctx *Context) genSid(key string) string {
 }
 
 // Recover recovers form panics.
-// It logs the stack and uses the PanicHandler (or a classic Internal Server Error) to write the response.
+// A panicked ICoreError is responded with Fail. The other panics are logged with their stack, reported to the
+// ErrorReporter, and the response is written by the PanicHandler (or a classic Internal Server Error).
+// A panic of the PanicHandler or of the ErrorReporter is recovered too.
 //
 // Usage:
 //
 //	defer c.Recover()
 func (ctx *Context) Recover() {
 	if err := recover(); err != nil {
-		if e, ok := err.(*ValidationError); ok == true {
-			ctx.Fail(e)
-			return
-		}
+		ctx.recovered(err)
+	}
+}
 
-		stack := make([]byte, 64<<10)
-		n := runtime.Stack(stack[:], false)
-		log.WithFields(log.Fields{"path": ctx.Request.URL.Path}).Errorln(string(stack[:n]))
+// recovered handles the recovered panic err.
+func (ctx *Context) recovered(err interface{}) {
+	coreErr, isCoreErr := err.(ICoreError)
+	if isCoreErr && coreErr.GetHTTPCode() < http.StatusInternalServerError {
 		if !ctx.Written() {
-			ctx.ResponseWriter.Header().Del("Content-Type")
+			ctx.Fail(coreErr)
+		}
+		return
+	}
 
-			if ctx.handlersStack.PanicHandler != nil {
-				ctx.Data["panic"] = err
-				ctx.handlersStack.PanicHandler(ctx)
-			} else {
-				ctx.Fail((&ServerError{}).New(http.StatusText(http.StatusInternalServerError)))
-			}
+	stack := make([]byte, 64<<10)
+	stack = stack[:runtime.Stack(stack, false)]
+	report := newErrorReport(ctx, err, stack)
+	log.WithFields(log.Fields{"path": ctx.Request.URL.Path, "caller": report.Caller}).Errorln(fmt.Sprintf("%v\n%s", err, report.Stack))
+	if reporter := ctx.handlersStack.ErrorReporter; reporter != nil {
+		ctx.safely("ErrorReporter", func() { reporter.Report(report) })
+	}
+
+	if ctx.Written() {
+		return
+	}
+	ctx.ResponseWriter.Header().Del("Content-Type")
+	if isCoreErr {
+		ctx.Fail(coreErr)
+		return
+	}
+	if ctx.handlersStack.PanicHandler != nil {
+		ctx.Data["panic"] = err
+		ctx.safely("PanicHandler", func() { ctx.handlersStack.PanicHandler(ctx) })
+		if ctx.Written() {
+			return
 		}
 	}
+	ctx.Fail((&ServerError{}).New(http.StatusText(http.StatusInternalServerError)))
+}
+
+// safely calls f, its panic is logged instead of crashing the server.
+func (ctx *Context) safely(name string, f func()) {
+	defer func() {
+		if err := recover(); err != nil {
+			stack := make([]byte, 64<<10)
+			stack = stack[:runtime.Stack(stack, false)]
+			log.WithFields(log.Fields{"path": ctx.Request.URL.Path}).Errorln(fmt.Sprintf("%s panic: %v\n%s", name, err, trimStack(stack)))
+		}
+	}()
+	f()
 }
 
 // ctxPool
@@ -303,12 +376,23 @@ var ctxPool = sync.Pool{
 	},
 }
 
-func getContext(w http.ResponseWriter, r *http.Request) *Context {
+func getContext(hs *HandlersStack, w http.ResponseWriter, r *http.Request) *Context {
 	ctx := ctxPool.Get().(*Context)
 	ctx.Request = r
-	ctx.ResponseWriter = contextWriter{w, ctx}
+	ctx.ResponseWriter = contextWriter{ResponseWriter: w, context: ctx}
 	ctx.Data = make(map[string]interface{})
-	ctx.handlersStack = *defaultHandlersStack
+	// The error handlers of Routers run for the errors of the stack's middlewares too, the router sets its own engine.
+	ctx.engine = Routers
+	if r.Body != nil && r.Body != http.NoBody {
+		ctx.body = &limitedBody{ReadCloser: r.Body, max: MaxBodyBytes, contentLength: r.ContentLength}
+		r.Body = ctx.body
+	}
+	// Cap the handlers so that route handlers appended by the engine never share the stack's backing array.
+	ctx.handlersStack = HandlersStack{
+		Handlers:      hs.Handlers[:len(hs.Handlers):len(hs.Handlers)],
+		PanicHandler:  hs.PanicHandler,
+		ErrorReporter: hs.ErrorReporter,
+	}
 	return ctx
 }
 
@@ -323,23 +407,160 @@ func putContext(ctx *Context) {
 	ctx.index = -1
 	ctx.written = false
 	ctx.BodyJSON = nil
+	ctx.body = nil
+	ctx.bodyBuf = nil
+	ctx.streams = nil
+	ctx.status = 0
+	ctx.size = 0
+	ctx.writtenAt = time.Time{}
+	ctx.engine = nil
+	ctx.errorIndex = 0
+	ctx.errorID = ""
+	ctx.err = nil
 	ctxPool.Put(ctx)
 }
 
 // contextWriter represents a binder that catches a downstream response writing and sets the context's written flag on the first write.
+// The innermost contextWriter also records the status, the size and the time of the response, see WrapWriter.
 type contextWriter struct {
 	http.ResponseWriter
 	context *Context
+	wrapper bool // wraps a writer set by WrapWriter, the response is recorded by the innermost contextWriter
 }
 
 // Write sets the context's written flag before writing the response.
 func (w contextWriter) Write(p []byte) (int, error) {
 	w.context.written = true
-	return w.ResponseWriter.Write(p)
+	w.writeHeader(http.StatusOK)
+	n, err := w.ResponseWriter.Write(p)
+	if w.wrapper == false {
+		w.context.size += int64(n)
+	}
+	return n, err
 }
 
 // WriteHeader sets the context's written flag before writing the response header.
 func (w contextWriter) WriteHeader(code int) {
 	w.context.written = true
+	w.writeHeader(code)
 	w.ResponseWriter.WriteHeader(code)
 }
+
+// writeHeader records the status of the response header.
+func (w contextWriter) writeHeader(code int) {
+	if w.wrapper == false && w.context.status == 0 {
+		w.context.status = code
+		w.context.writtenAt = time.Now()
+	}
+}
+
+// Flush sends the buffered data to the client, if the underlying writer supports it.
+func (w contextWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok && canFlush(w.ResponseWriter) {
+		w.context.written = true
+		w.writeHeader(http.StatusOK)
+		f.Flush()
+	}
+}
+
+// Hijack lets the handler take over the connection, see http.Hijacker.
+func (w contextWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if ok == false {
+		return nil, nil, errors.New("the response writer does not support hijacking")
+	}
+	w.context.written = true
+	w.writeHeader(http.StatusSwitchingProtocols)
+	return h.Hijack()
+}
+
+// Push initiates an HTTP/2 server push, see http.Pusher.
+func (w contextWriter) Push(target string, opts *http.PushOptions) error {
+	for rw := w.ResponseWriter; rw != nil; rw = unwrapWriter(rw) {
+		if p, ok := rw.(http.Pusher); ok {
+			return p.Push(target, opts)
+		}
+	}
+	return http.ErrNotSupported
+}
+
+// ReadFrom copies r to the response, with sendfile if the underlying writer supports it.
+func (w contextWriter) ReadFrom(r io.Reader) (int64, error) {
+	w.context.written = true
+	w.writeHeader(http.StatusOK)
+	var n int64
+	var err error
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(r)
+	} else {
+		n, err = io.Copy(w.ResponseWriter, r)
+	}
+	if w.wrapper == false {
+		w.context.size += n
+	}
+	return n, err
+}
+
+// Status returns the status of the response.
+func (w contextWriter) Status() int {
+	return w.context.status
+}
+
+// Unwrap returns the underlying writer.
+func (w contextWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// unwrapWriter returns the writer wrapped by w, or nil.
+func unwrapWriter(w http.ResponseWriter) http.ResponseWriter {
+	if u, ok := w.(interface{ Unwrap() http.ResponseWriter }); ok {
+		return u.Unwrap()
+	}
+	return nil
+}
+
+// canFlush tells if the innermost writer wrapped by w supports flushing, the wrappers are http.Flusher anyway.
+func canFlush(w http.ResponseWriter) bool {
+	for u := unwrapWriter(w); u != nil; u = unwrapWriter(w) {
+		w = u
+	}
+	_, ok := w.(http.Flusher)
+	return ok
+}
+
+// WrapWriter replaces the response writer by the writer returned by wrap, which writes to the current one.
+// The writes to the new writer still set the written flag, and Status, Size and WrittenAt keep describing the response sent to the client.
+// The returned func restores the previous writer:
+//
+//	restore := ctx.WrapWriter(func(w http.ResponseWriter) http.ResponseWriter {
+//		return &myWriter{ResponseWriter: w}
+//	})
+//	defer restore()
+//	ctx.Next()
+func (ctx *Context) WrapWriter(wrap func(w http.ResponseWriter) http.ResponseWriter) (restore func()) {
+	prev := ctx.ResponseWriter
+	ctx.ResponseWriter = contextWriter{ResponseWriter: wrap(prev), context: ctx, wrapper: true}
+	return func() {
+		ctx.ResponseWriter = prev
+		// Once the last wrapper is removed, the response is written only if it reached the client:
+		// a wrapper dropping its buffer on panic lets Recover send the error.
+		if w, ok := prev.(contextWriter); ok && w.wrapper == false {
+			ctx.written = ctx.status != 0
+		}
+	}
+}
+
+// Status returns the status of the response, 0 if the header is not written yet.
+func (ctx *Context) Status() int {
+	return ctx.status
+}
+
+// Size returns the number of bytes of the response body written so far, after compression.
+func (ctx *Context) Size() int64 {
+	return ctx.size
+}
+
+// WrittenAt returns the time the response header was written, zero if it is not written yet.
+func (ctx *Context) WrittenAt() time.Time {
+	return ctx.writtenAt
+}
@@ -6,12 +6,14 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestRecover(t *testing.T) {
 	statusWant := http.StatusInternalServerError
-	bodyWant := http.StatusText(http.StatusInternalServerError) + "\n"
+	bodyWant := `{"ok":false,"data":null,"message":"Internal Server Error","errno":0}`
 
 	hs := NewHandlersStack()
 	hs.Use(func(c *Context) {
@@ -78,3 +80,129 @@ func TestRecoverCustom(t *testing.T) {
 		t.Errorf("body: want %q, got %q", bodyWant, bodyGot)
 	}
 }
+
+func TestRecoverCoreError(t *testing.T) {
+	var reports []*ErrorReport
+	hs := NewHandlersStack()
+	hs.ReportErrors(ErrorReporterFunc(func(r *ErrorReport) {
+		reports = append(reports, r)
+	}))
+	hs.Use(func(c *Context) {
+		switch c.Request.URL.Path {
+		case "/validation":
+			panic((&ValidationError{}).New("id格式错误"))
+		case "/db":
+			panic((&DBError{}).New("users", "db down"))
+		}
+	})
+
+	tests := []struct {
+		path    string
+		code    int
+		message string
+		reports int
+	}{
+		{"/validation", http.StatusBadRequest, "id格式错误", 0},
+		{"/db", http.StatusInternalServerError, "db down", 1},
+	}
+	for _, tt := range tests {
+		reports = nil
+		r, _ := http.NewRequest("GET", tt.path, nil)
+		r.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		hs.ServeHTTP(w, r)
+		if w.Code != tt.code || strings.Contains(w.Body.String(), tt.message) == false {
+			t.Errorf("%s: want %d %q, got %d %s", tt.path, tt.code, tt.message, w.Code, w.Body.String())
+		}
+		if len(reports) != tt.reports {
+			t.Fatalf("%s: want %d reports, got %d", tt.path, tt.reports, len(reports))
+		}
+		if tt.reports > 0 {
+			report := reports[0]
+			if report.URL != tt.path || report.Header.Get("Authorization") != "[FILTERED]" || report.Caller != "core" || report.Stack == "" {
+				t.Errorf("%s: want request snapshot, got %+v", tt.path, report)
+			}
+		}
+	}
+}
+
+func TestRecoverPanicHandlerPanic(t *testing.T) {
+	hs := NewHandlersStack()
+	hs.HandlePanic(func(c *Context) {
+		panic("panic handler")
+	})
+	hs.ReportErrors(ErrorReporterFunc(func(r *ErrorReport) {
+		panic("reporter")
+	}))
+	hs.Use(func(c *Context) {
+		panic("handler")
+	})
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	hs.ServeHTTP(w, r)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("want 500, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestResponseRecording(t *testing.T) {
+	var status int
+	var size int64
+	var writtenAt time.Time
+	hs := NewHandlersStack()
+	hs.Use(func(c *Context) {
+		c.Next()
+		status, size, writtenAt = c.Status(), c.Size(), c.WrittenAt()
+	})
+	hs.Use(Compress(CompressConfig{MinSize: 1}))
+	hs.Use(func(c *Context) {
+		if c.Status() != 0 || c.WrittenAt().IsZero() == false {
+			t.Errorf("want nothing recorded before writing, got %d", c.Status())
+		}
+		c.ResponseWriter.Header().Set("Content-Type", "text/plain")
+		c.ResponseWriter.WriteHeader(http.StatusCreated)
+		c.ResponseWriter.Write([]byte(strings.Repeat("a", 1000)))
+	})
+
+	for _, encoding := range []string{"", "gzip"} {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Encoding", encoding)
+		w := httptest.NewRecorder()
+		hs.ServeHTTP(w, r)
+		if status != http.StatusCreated {
+			t.Errorf("%q: status: want %d, got %d", encoding, http.StatusCreated, status)
+		}
+		if size != int64(w.Body.Len()) {
+			t.Errorf("%q: size: want %d, got %d", encoding, w.Body.Len(), size)
+		}
+		if writtenAt.IsZero() {
+			t.Errorf("%q: want header written time", encoding)
+		}
+	}
+}
+
+func TestWrapWriter(t *testing.T) {
+	hs := NewHandlersStack()
+	hs.Use(func(c *Context) {
+		restore := c.WrapWriter(func(w http.ResponseWriter) http.ResponseWriter {
+			return struct{ http.ResponseWriter }{w}
+		})
+		defer restore()
+		if _, ok := c.ResponseWriter.(http.Flusher); ok == false {
+			t.Error("want wrapped writer to be a Flusher")
+		}
+		if err := c.ResponseWriter.(http.Pusher).Push("/app.js", nil); err != http.ErrNotSupported {
+			t.Errorf("push: want ErrNotSupported, got %v", err)
+		}
+		c.Next()
+	})
+	hs.Use(func(c *Context) {
+		c.ResponseWriter.Write([]byte("ok"))
+	})
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	hs.ServeHTTP(w, r)
+	if w.Body.String() != "ok" || w.Code != http.StatusOK {
+		t.Errorf("want 200 ok, got %d %q", w.Code, w.Body.String())
+	}
+}
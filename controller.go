@@ -3,7 +3,6 @@ package core
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net/url"
 	"reflect"
 	"strconv"
@@ -26,19 +25,26 @@ type Controller struct {
 func (c *Controller) RegisterRouter() {
 }
 
+// Register is called by RouterGroup.Controller after the actions are registered, override it to register more routes.
+func (c *Controller) Register() {
+}
+
 // Err return a controller error
 func (c *Controller) Err(errno int, message string) error {
 	return (&BusinessError{}).New(errno, message)
 }
 
 // GetBodyJSON return a json from body
+// It panics with the error of the body if it can not be read, e.g. a PayloadTooLargeError.
 func (c *Controller) GetBodyJSON(ctx *Context) map[string]interface{} {
 	if ctx.BodyJSON != nil {
 		return ctx.BodyJSON
 	}
 	var reqJSON map[string]interface{}
-	body, _ := ioutil.ReadAll(ctx.Request.Body)
-	defer ctx.Request.Body.Close()
+	body, err := ctx.Body()
+	if err != nil {
+		panic(err)
+	}
 
 	cType := ctx.Request.Header.Get("Content-Type")
 	a := strings.Split(cType, ";")
@@ -0,0 +1,103 @@
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ControllerRoute describes a route of a controller action, see IControllerRoutes.
+type ControllerRoute struct {
+	Method      string          // http method
+	Path        string          // path relative to the controller path
+	Action      string          // name of the controller method, its signature must be func(*Context)
+	Middlewares []RouterHandler // middlewares of the action
+	Name        string          // route name, default is <controller>.<action>
+}
+
+// IControllerRoutes is implemented by controllers declaring their own routes.
+type IControllerRoutes interface {
+	Routes() []ControllerRoute
+}
+
+// IControllerMiddlewares is implemented by controllers having per action middlewares.
+// The keys are action names, "*" applies to all the actions.
+type IControllerMiddlewares interface {
+	Middlewares() map[string][]RouterHandler
+}
+
+// restActions are the conventional actions of a controller.
+var restActions = []ControllerRoute{
+	{Method: "GET", Path: "", Action: "Index"},
+	{Method: "GET", Path: "/:id", Action: "Show"},
+	{Method: "POST", Path: "", Action: "Create"},
+	{Method: "PUT", Path: "/:id", Action: "Update"},
+	{Method: "PATCH", Path: "/:id", Action: "Update"},
+	{Method: "DELETE", Path: "/:id", Action: "Destroy"},
+}
+
+// Controller registers the actions of the controller under the relative path:
+//
+//	Index   GET    /users
+//	Show    GET    /users/:id
+//	Create  POST   /users
+//	Update  PUT    /users/:id, PATCH /users/:id
+//	Destroy DELETE /users/:id
+//
+// Only the actions the controller has are registered, as well as the routes returned by Routes
+// if the controller implements IControllerRoutes. The controller is injected by Services, see Container.Inject,
+// then its Register method is called, so it can register more routes by hand.
+func (group *RouterGroup) Controller(relativePath string, c IController) *RouterGroup {
+	v := reflect.ValueOf(c)
+	assert1(v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Struct, "controller must be a pointer to a struct")
+	err := Services.Inject(c)
+	assert1(err == nil, fmt.Sprintf("inject %s: %v", v.Type(), err))
+
+	g := group.Group(relativePath)
+	prefix := strings.ToLower(strings.TrimSuffix(v.Elem().Type().Name(), "Controller"))
+	var middlewares map[string][]RouterHandler
+	if cm, ok := c.(IControllerMiddlewares); ok {
+		middlewares = cm.Middlewares()
+	}
+
+	routes := []ControllerRoute{}
+	for _, r := range restActions {
+		if v.MethodByName(r.Action).IsValid() {
+			routes = append(routes, r)
+		}
+	}
+	if cr, ok := c.(IControllerRoutes); ok {
+		routes = append(routes, cr.Routes()...)
+	}
+	named := map[string]bool{}
+	for _, r := range routes {
+		m := v.MethodByName(r.Action)
+		assert1(m.IsValid(), fmt.Sprintf("%s has no action %s", v.Type(), r.Action))
+		action, ok := m.Interface().(func(*Context))
+		assert1(ok, fmt.Sprintf("%s.%s must be func(*core.Context)", v.Type(), r.Action))
+
+		handlers := RouterHandlerChain{}
+		handlers = append(handlers, middlewares["*"]...)
+		handlers = append(handlers, middlewares[r.Action]...)
+		handlers = append(handlers, r.Middlewares...)
+		handlers = append(handlers, action)
+		route := g.Handle(r.Method, r.Path, handlers...)
+
+		name := r.Name
+		if name == "" {
+			name = prefix + "." + strings.ToLower(r.Action)
+		}
+		// PUT and PATCH of Update share the route name.
+		if named[name] {
+			for _, info := range route.routes {
+				info.Name = name
+			}
+			continue
+		}
+		named[name] = true
+		route.Name(name)
+	}
+
+	c.Register()
+	return g
+}
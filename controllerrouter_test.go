@@ -0,0 +1,79 @@
+package core
+
+import (
+	"net/http"
+	"testing"
+)
+
+type orderService struct {
+	Service
+}
+
+type OrderController struct {
+	Controller
+	Orders     *orderService
+	registered bool
+}
+
+func (c *OrderController) Index(ctx *Context) {
+	ctx.Ok("index")
+}
+
+func (c *OrderController) Show(ctx *Context) {
+	ctx.Ok(c.IntRange("id", ctx.Param("id"), 1, 100))
+}
+
+func (c *OrderController) Update(ctx *Context) {
+	ctx.Ok("update " + ctx.Param("id"))
+}
+
+func (c *OrderController) Cancel(ctx *Context) {
+	ctx.Ok("cancel " + ctx.Param("id"))
+}
+
+func (c *OrderController) Routes() []ControllerRoute {
+	return []ControllerRoute{{Method: "POST", Path: "/:id/cancel", Action: "Cancel"}}
+}
+
+func (c *OrderController) Middlewares() map[string][]RouterHandler {
+	return map[string][]RouterHandler{"Cancel": {RequireRole("admin")}}
+}
+
+func (c *OrderController) Register() {
+	c.registered = true
+}
+
+func TestController(t *testing.T) {
+	engine := create()
+	c := &OrderController{}
+	engine.Controller("/orders", c)
+
+	if c.Validate == nil || c.Orders == nil || c.Orders.Validate == nil || c.registered == false {
+		t.Fatalf("controller is not initialized: %+v", c)
+	}
+
+	tests := []struct {
+		method, path string
+		code         int
+		body         string
+	}{
+		{"GET", "/orders", http.StatusOK, `"index"`},
+		{"GET", "/orders/42", http.StatusOK, `42`},
+		{"GET", "/orders/420", http.StatusBadRequest, ""},
+		{"PATCH", "/orders/42", http.StatusOK, `"update 42"`},
+		{"DELETE", "/orders/42", http.StatusNotFound, ""},
+		{"POST", "/orders/42/cancel", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		r, _ := http.NewRequest(tt.method, tt.path, nil)
+		w := performRequest(engine, r)
+		body := `{"ok":true,"data":` + tt.body + `,"message":"","errno":0}`
+		if w.Code != tt.code || (tt.body != "" && w.Body.String() != body) {
+			t.Errorf("%s %s: want %d %s, got %d %s", tt.method, tt.path, tt.code, body, w.Code, w.Body.String())
+		}
+	}
+
+	if url, err := engine.URL("order.show", 7); err != nil || url != "/orders/7" {
+		t.Errorf("URL(order.show): got %q, %v", url, err)
+	}
+}
@@ -81,15 +81,13 @@ Panic recovering
 
 When using Run, your server always recovers from panics, logs the error with stack, and sends a 500 Internal Server Error.
 If you want to use a custom handler on panic, give one to HandlePanic.
+Errors passed to Context.Fail go through the handlers given to Routers.OnError, see ErrorIDs and HideInternalErrors.
 
 Handlers and helpers
 
 No handlers or helpers are bundled in the core: it does one thing and does it well.
 That's why you have to import all and only the handlers or helpers you need:
 
-	compress
-		Clever response compressing
-		github.com/HiLittleCat/compress
 	cors
 		Cross-Origin Resource Sharing support
 		https://godoc.org/github.com/HiLittleCat/cors
@@ -105,8 +103,11 @@ That's why you have to import all and only the handlers or helpers you need:
 	secure
 		Quick security wins
 		https://godoc.org/github.com/HiLittleCat/secure
-	static
-		Simple assets serving
-		https://godoc.org/github.com/HiLittleCat/static
+
+Static files are served by RouterGroup.Static, StaticFS and StaticFile, and responses are compressed by the Compress middleware.
+GET responses are cached by the Cache middleware, in memory or in redis, and invalidated by tags with InvalidateCache.
+Unsafe requests having an Idempotency-Key header are made idempotent by the Idempotency middleware.
+Routes are protected from overload by a Bulkhead, and downstream calls by a Breaker.
+The server lifecycle is observed with OnInit, OnStart, OnRequest, OnResponse, OnShutdown and OnStop.
 */
 package core
@@ -0,0 +1,247 @@
+package core
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ArchiveEntry is a file of an archive streamed by ZipStream or TarGzStream, read from Path or from Reader.
+type ArchiveEntry struct {
+	Name     string      // name in the archive, default is the base name of Path
+	Path     string      // file to add
+	Reader   io.Reader   // content to add if Path is empty
+	Size     int64       // size of Reader, a tar.gz buffers the readers without size
+	Modified time.Time   // default is the modification time of the file, or now
+	Mode     os.FileMode // default is 0644
+}
+
+// File responds the content of the file, with its Content-Type, Content-Length, Last-Modified and ETag.
+// Conditional and Range requests are supported, so downloads can be resumed.
+func (ctx *Context) File(filePath string) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		ctx.Fail((&NotFoundError{}).New("File not found"))
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		ctx.Fail((&NotFoundError{}).New("File not found"))
+		return
+	}
+	h := ctx.ResponseWriter.Header()
+	h.Del("Content-Type")
+	if ct := mime.TypeByExtension(filepath.Ext(filePath)); ct != "" {
+		h.Set("Content-Type", ct)
+	}
+	h.Set("ETag", fileETag(info))
+	http.ServeContent(ctx.ResponseWriter, ctx.Request, info.Name(), info.ModTime(), f)
+}
+
+// Attachment responds the file as a download named name, default is the base name of the file.
+func (ctx *Context) Attachment(filePath, name string) {
+	if name == "" {
+		name = filepath.Base(filePath)
+	}
+	ctx.ResponseWriter.Header().Set("Content-Disposition", ContentDisposition("attachment", name))
+	ctx.File(filePath)
+}
+
+// ContentDisposition returns a Content-Disposition header value of the kind ("attachment" or "inline") and file name.
+// Non ASCII names are encoded as RFC 5987 filename*, with an ASCII fallback for the old clients (RFC 6266).
+func ContentDisposition(kind, name string) string {
+	ascii := true
+	fallback := make([]byte, 0, len(name))
+	for _, r := range name {
+		switch {
+		case r > 0x7e || r < 0x20:
+			ascii = false
+			fallback = append(fallback, '_')
+		case r == '"' || r == '\\':
+			fallback = append(fallback, '_')
+		default:
+			fallback = append(fallback, byte(r))
+		}
+	}
+	v := kind + `; filename="` + string(fallback) + `"`
+	if ascii == false {
+		v += "; filename*=UTF-8''" + encodeRFC5987(name)
+	}
+	return v
+}
+
+// encodeRFC5987 percent encodes the bytes of s except the attr-char.
+func encodeRFC5987(s string) string {
+	const attrChar = "!#$&+-.^_`|~"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte(attrChar, c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// ZipStream responds a zip archive of the entries named name, the files are compressed while they are sent.
+// The entries are checked before responding: an error is responded if a file can not be read.
+// The returned error tells if the archive has been interrupted, the response can not be changed then.
+func (ctx *Context) ZipStream(name string, entries []ArchiveEntry) error {
+	if err := ctx.startArchive(name, "application/zip", entries); err != nil {
+		return err
+	}
+	zw := zip.NewWriter(ctx.ResponseWriter)
+	for _, e := range entries {
+		err := e.open(func(r io.Reader, info archiveInfo) error {
+			fh := &zip.FileHeader{Name: info.name, Method: zip.Deflate, Modified: info.modified}
+			fh.SetMode(info.mode)
+			w, err := zw.CreateHeader(fh)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(w, r)
+			return err
+		})
+		if err != nil {
+			return ctx.archiveFailed(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return ctx.archiveFailed(err)
+	}
+	return nil
+}
+
+// TarGzStream responds a tar.gz archive of the entries named name, see ZipStream.
+func (ctx *Context) TarGzStream(name string, entries []ArchiveEntry) error {
+	if err := ctx.startArchive(name, "application/gzip", entries); err != nil {
+		return err
+	}
+	gw := gzip.NewWriter(ctx.ResponseWriter)
+	tw := tar.NewWriter(gw)
+	for _, e := range entries {
+		err := e.open(func(r io.Reader, info archiveInfo) error {
+			if info.size < 0 {
+				// tar needs the size in the header.
+				b, err := ioutil.ReadAll(r)
+				if err != nil {
+					return err
+				}
+				r, info.size = bytes.NewReader(b), int64(len(b))
+			}
+			hdr := &tar.Header{
+				Typeflag: tar.TypeReg,
+				Name:     info.name,
+				Size:     info.size,
+				Mode:     int64(info.mode.Perm()),
+				ModTime:  info.modified,
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			_, err := io.Copy(tw, r)
+			return err
+		})
+		if err != nil {
+			return ctx.archiveFailed(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return ctx.archiveFailed(err)
+	}
+	if err := gw.Close(); err != nil {
+		return ctx.archiveFailed(err)
+	}
+	return nil
+}
+
+// startArchive checks the files of the entries and writes the response header.
+func (ctx *Context) startArchive(name, contentType string, entries []ArchiveEntry) error {
+	for _, e := range entries {
+		if e.Path == "" {
+			if e.Reader == nil {
+				err := (&ServerError{}).New("archive entry " + e.Name + " has no content")
+				ctx.Fail(err)
+				return err
+			}
+			continue
+		}
+		if info, err := os.Stat(e.Path); err != nil || info.IsDir() {
+			err = (&NotFoundError{}).New("File not found")
+			ctx.Fail(err)
+			return err
+		}
+	}
+	h := ctx.ResponseWriter.Header()
+	h.Set("Content-Type", contentType)
+	h.Set("Content-Disposition", ContentDisposition("attachment", name))
+	h.Del("Content-Length")
+	ctx.ResponseWriter.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// archiveFailed logs the error of an interrupted archive.
+func (ctx *Context) archiveFailed(err error) error {
+	log.WithFields(log.Fields{"path": ctx.Request.URL.Path}).Warnln("archive interrupted: " + err.Error())
+	return err
+}
+
+type archiveInfo struct {
+	name     string
+	size     int64 // -1 if unknown
+	mode     os.FileMode
+	modified time.Time
+}
+
+// open calls add with the content of the entry.
+func (e ArchiveEntry) open(add func(r io.Reader, info archiveInfo) error) error {
+	info := archiveInfo{name: e.Name, size: -1, mode: e.Mode, modified: e.Modified}
+	r := e.Reader
+	if e.Path != "" {
+		f, err := os.Open(e.Path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		fi, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		r, info.size = f, fi.Size()
+		if info.name == "" {
+			info.name = fi.Name()
+		}
+		if info.mode == 0 {
+			info.mode = fi.Mode().Perm()
+		}
+		if info.modified.IsZero() {
+			info.modified = fi.ModTime()
+		}
+	} else if e.Size > 0 {
+		info.size = e.Size
+		r = io.LimitReader(r, e.Size)
+	}
+	if info.mode == 0 {
+		info.mode = 0644
+	}
+	if info.modified.IsZero() {
+		info.modified = time.Now()
+	}
+	info.name = strings.TrimPrefix(filepath.ToSlash(info.name), "/")
+	return add(r, info)
+}
@@ -0,0 +1,108 @@
+package core
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestContentDisposition(t *testing.T) {
+	tests := map[string]string{
+		"report.pdf":   `attachment; filename="report.pdf"`,
+		`a"b.txt`:      `attachment; filename="a_b.txt"`,
+		"报表 2024.xlsx": `attachment; filename="__ 2024.xlsx"; filename*=UTF-8''%E6%8A%A5%E8%A1%A8%202024.xlsx`,
+	}
+	for name, want := range tests {
+		if got := ContentDisposition("attachment", name); got != want {
+			t.Errorf("%s: want %s, got %s", name, want, got)
+		}
+	}
+}
+
+func TestAttachment(t *testing.T) {
+	dir := staticDir(t)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "docs/readme.txt")
+	engine := create()
+	engine.GET("/download", func(c *Context) { c.Attachment(file, "说明.txt") })
+	engine.GET("/missing", func(c *Context) { c.File(filepath.Join(dir, "missing")) })
+
+	r, _ := http.NewRequest("GET", "/download", nil)
+	r.Header.Set("Range", "bytes=5-")
+	w := performRequest(engine, r)
+	if w.Code != http.StatusPartialContent || w.Body.String() != "56789" || w.Header().Get("Content-Length") != "5" {
+		t.Errorf("want partial 56789, got %d %q %q", w.Code, w.Body.String(), w.Header().Get("Content-Length"))
+	}
+	if cd := w.Header().Get("Content-Disposition"); strings.Contains(cd, "filename*=UTF-8''%E8%AF%B4%E6%98%8E.txt") == false {
+		t.Errorf("want encoded file name, got %s", cd)
+	}
+	r, _ = http.NewRequest("GET", "/missing", nil)
+	if w = performRequest(engine, r); w.Code != http.StatusNotFound {
+		t.Errorf("want 404, got %d", w.Code)
+	}
+}
+
+func TestArchiveStream(t *testing.T) {
+	dir := staticDir(t)
+	defer os.RemoveAll(dir)
+	entries := []ArchiveEntry{
+		{Path: filepath.Join(dir, "docs/readme.txt"), Name: "docs/readme.txt"},
+		{Name: "hello.txt", Reader: strings.NewReader("hello")},
+	}
+	engine := create()
+	engine.GET("/zip", func(c *Context) { c.ZipStream("files.zip", entries) })
+	engine.GET("/tgz", func(c *Context) { c.TarGzStream("files.tar.gz", entries) })
+	engine.GET("/bad", func(c *Context) {
+		c.ZipStream("files.zip", []ArchiveEntry{{Path: filepath.Join(dir, "missing")}})
+	})
+	want := map[string]string{"docs/readme.txt": "0123456789", "hello.txt": "hello"}
+
+	r, _ := http.NewRequest("GET", "/zip", nil)
+	w := performRequest(engine, r)
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		b, _ := ioutil.ReadAll(rc)
+		if want[f.Name] != string(b) {
+			t.Errorf("zip %s: want %q, got %q", f.Name, want[f.Name], b)
+		}
+	}
+	if len(zr.File) != 2 || w.Header().Get("Content-Type") != "application/zip" {
+		t.Errorf("want 2 zipped files, got %d %s", len(zr.File), w.Header().Get("Content-Type"))
+	}
+
+	entries[1].Reader = strings.NewReader("hello")
+	r, _ = http.NewRequest("GET", "/tgz", nil)
+	w = performRequest(engine, r)
+	gr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gr)
+	n := 0
+	for hdr, err := tr.Next(); err == nil; hdr, err = tr.Next() {
+		b, _ := ioutil.ReadAll(tr)
+		if want[hdr.Name] != string(b) {
+			t.Errorf("tar %s: want %q, got %q", hdr.Name, want[hdr.Name], b)
+		}
+		n++
+	}
+	if n != 2 {
+		t.Errorf("want 2 files in the tar, got %d", n)
+	}
+
+	r, _ = http.NewRequest("GET", "/bad", nil)
+	if w = performRequest(engine, r); w.Code != http.StatusNotFound {
+		t.Errorf("want 404 for a missing entry, got %d", w.Code)
+	}
+}
@@ -0,0 +1,93 @@
+package core
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrorHandler handles an error passed to Context.Fail, it returns true if it responded.
+// Otherwise the next handler is run, and the error is rendered as a ResFormat after the last one.
+// A handler can map the error to another one by calling Fail with it, the next handlers receive the new error.
+type ErrorHandler func(ctx *Context, err error) bool
+
+// OnError appends error handlers to the chain run by Context.Fail, in order:
+//
+//	core.Routers.OnError(
+//		func(ctx *core.Context, err error) bool {
+//			if err == mgo.ErrNotFound {
+//				ctx.Fail((&core.NotFoundError{}).New("记录不存在"))
+//				return true
+//			}
+//			return false
+//		},
+//		core.ErrorIDs(nil),
+//		core.HideInternalErrors,
+//	)
+//
+// The host engines share the chain of the default engine.
+// The chain of Routers also runs for the errors of the handlers stack's middlewares, before routing.
+func (engine *Engine) OnError(handlers ...ErrorHandler) {
+	engine.errorHandlers = append(engine.errorHandlers, handlers...)
+}
+
+// Error records err to be rendered with Fail once the handlers returned, if they did not respond.
+// The last recorded error is rendered.
+func (ctx *Context) Error(err error) {
+	ctx.err = err
+}
+
+// Err returns the error recorded by Error.
+func (ctx *Context) Err() error {
+	return ctx.err
+}
+
+// ErrorID returns the id of the error responded, see ErrorIDs.
+func (ctx *Context) ErrorID() string {
+	return ctx.errorID
+}
+
+// ErrorIDs returns an error handler giving an id to the server errors, so that the support can find them in the logs.
+// The id is logged with the error, sent in the X-Error-Id header and in the errorId field of the response.
+// The ids are made by gen, default is 16 random hex digits.
+func ErrorIDs(gen func() string) ErrorHandler {
+	if gen == nil {
+		gen = func() string {
+			b := make([]byte, 8)
+			rand.Read(b)
+			return hex.EncodeToString(b)
+		}
+	}
+	return func(ctx *Context, err error) bool {
+		if errorStatus(err) < http.StatusInternalServerError {
+			return false
+		}
+		ctx.errorID = gen()
+		ctx.ResponseWriter.Header().Set("X-Error-Id", ctx.errorID)
+		log.WithFields(log.Fields{"path": ctx.Request.URL.Path, "errorId": ctx.errorID}).Errorln(err.Error())
+		return false
+	}
+}
+
+// HideInternalErrors is an error handler hiding the messages of the internal server errors in Production,
+// they are replaced by the status text. The original error is logged.
+func HideInternalErrors(ctx *Context, err error) bool {
+	if Production == false || errorStatus(err) != http.StatusInternalServerError {
+		return false
+	}
+	if ctx.errorID == "" {
+		log.WithFields(log.Fields{"path": ctx.Request.URL.Path}).Errorln(err.Error())
+	}
+	ctx.Fail((&ServerError{}).New(http.StatusText(http.StatusInternalServerError)))
+	return true
+}
+
+// errorStatus returns the response status of err.
+func errorStatus(err error) int {
+	if e, ok := err.(ICoreError); ok {
+		return e.GetHTTPCode()
+	}
+	return http.StatusInternalServerError
+}
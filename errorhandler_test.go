@@ -0,0 +1,110 @@
+package core
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var errNoRows = errors.New("sql: no rows in result set")
+
+func TestOnError(t *testing.T) {
+	var order []string
+	engine := create()
+	engine.OnError(
+		func(ctx *Context, err error) bool {
+			order = append(order, "db")
+			if err == errNoRows {
+				ctx.Fail((&DBError{}).New("users", "查询失败"))
+				return true
+			}
+			return false
+		},
+		ErrorIDs(func() string { return "e1" }),
+		func(ctx *Context, err error) bool {
+			order = append(order, "last:"+err.Error())
+			return false
+		},
+	)
+	engine.GET("/db", func(c *Context) { c.Fail(errNoRows) })
+	engine.GET("/business", func(c *Context) { c.Fail((&BusinessError{}).New(7, "余额不足")) })
+	engine.GET("/deferred", func(c *Context) {
+		c.Error((&ValidationError{}).New("first"))
+		c.Error((&NotFoundError{}).New("user"))
+	})
+
+	w := performRequest(engine, httptest.NewRequest("GET", "/db", nil))
+	if w.Code != http.StatusInternalServerError || w.Header().Get("X-Error-Id") != "e1" {
+		t.Errorf("db: want 500 with error id, got %d %v", w.Code, w.Header())
+	}
+	if body := w.Body.String(); strings.Contains(body, `"errorId":"e1"`) == false || strings.Contains(body, "查询失败") == false {
+		t.Errorf("db: want the mapped error with its id, got %s", body)
+	}
+	if strings.Join(order, ",") != "db,last:查询失败" {
+		t.Errorf("db: want the next handlers to get the mapped error, got %v", order)
+	}
+
+	order = nil
+	w = performRequest(engine, httptest.NewRequest("GET", "/business", nil))
+	if w.Code != http.StatusBadRequest || w.Header().Get("X-Error-Id") != "" || strings.Contains(w.Body.String(), "errorId") {
+		t.Errorf("business: want 400 without error id, got %d %s", w.Code, w.Body.String())
+	}
+	if strings.Join(order, ",") != "db,last:余额不足" {
+		t.Errorf("business: want all the handlers, got %v", order)
+	}
+
+	order = nil
+	w = performRequest(engine, httptest.NewRequest("GET", "/deferred", nil))
+	if w.Code != http.StatusNotFound || strings.Contains(w.Body.String(), "user") == false {
+		t.Errorf("deferred: want the last error rendered, got %d %s", w.Code, w.Body.String())
+	}
+	if len(order) != 2 {
+		t.Errorf("deferred: want the handlers run once, got %v", order)
+	}
+}
+
+func TestHideInternalErrors(t *testing.T) {
+	defer func(p bool) { Production = p }(Production)
+	engine := create()
+	engine.OnError(HideInternalErrors)
+	engine.GET("/", func(c *Context) { c.Fail((&DBError{}).New("users", "dial tcp 10.0.0.1:3306: refused")) })
+	engine.GET("/bad", func(c *Context) { c.Fail((&ValidationError{}).New("name不能为空")) })
+
+	for _, test := range []struct {
+		production bool
+		path, want string
+	}{
+		{false, "/", "refused"},
+		{true, "/", http.StatusText(http.StatusInternalServerError)},
+		{true, "/bad", "name不能为空"},
+	} {
+		Production = test.production
+		w := performRequest(engine, httptest.NewRequest("GET", test.path, nil))
+		if strings.Contains(w.Body.String(), test.want) == false {
+			t.Errorf("production %t %s: want %q, got %s", test.production, test.path, test.want, w.Body.String())
+		}
+		if test.production && strings.Contains(w.Body.String(), "10.0.0.1") {
+			t.Errorf("production %t %s: internal message leaked: %s", test.production, test.path, w.Body.String())
+		}
+	}
+}
+
+func TestOnErrorBeforeRouting(t *testing.T) {
+	defer func(p bool, handlers []ErrorHandler) {
+		Production = p
+		Routers.errorHandlers = handlers
+	}(Production, Routers.errorHandlers)
+	Production = true
+	Routers.errorHandlers = nil
+	Routers.OnError(HideInternalErrors)
+
+	hs := NewHandlersStack()
+	hs.Use(func(c *Context) { c.Fail((&DBError{}).New("sessions", "dial tcp 10.0.0.1:6379: refused")) })
+	w := httptest.NewRecorder()
+	hs.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "10.0.0.1") {
+		t.Errorf("want the internal message hidden, got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -2,6 +2,7 @@ package core
 
 import (
 	"net/http"
+	"time"
 )
 
 // ICoreError core error interface
@@ -107,3 +108,72 @@ func (e *NotFoundError) New(message string) *NotFoundError {
 	e.Message = message
 	return e
 }
+
+// AuthError authentication failed, HTTPCode is http.StatusUnauthorized or http.StatusForbidden.
+type AuthError struct {
+	coreError
+	Challenge string // WWW-Authenticate header value
+}
+
+// New AuthError.New
+func (e *AuthError) New(httpCode int, challenge string, message string) *AuthError {
+	e.HTTPCode = httpCode
+	e.Errno = 0
+	e.Message = message
+	e.Challenge = challenge
+	return e
+}
+
+// ForbiddenError the principal is not allowed to access the resource.
+type ForbiddenError struct {
+	coreError
+}
+
+// New ForbiddenError.New
+func (e *ForbiddenError) New(message string) *ForbiddenError {
+	e.HTTPCode = http.StatusForbidden
+	e.Errno = 0
+	e.Message = message
+	return e
+}
+
+// PayloadTooLargeError the request body exceeds the limit.
+type PayloadTooLargeError struct {
+	coreError
+}
+
+// New PayloadTooLargeError.New
+func (e *PayloadTooLargeError) New(message string) *PayloadTooLargeError {
+	e.HTTPCode = http.StatusRequestEntityTooLarge
+	e.Errno = 0
+	e.Message = message
+	return e
+}
+
+// ConflictError the request conflicts with the state of the resource.
+type ConflictError struct {
+	coreError
+}
+
+// New ConflictError.New
+func (e *ConflictError) New(message string) *ConflictError {
+	e.HTTPCode = http.StatusConflict
+	e.Errno = 0
+	e.Message = message
+	return e
+}
+
+// UnavailableError the server is overloaded or a downstream service is down, the client can retry after RetryAfter.
+type UnavailableError struct {
+	coreError
+	RetryAfter time.Duration // Retry-After header value
+}
+
+// New UnavailableError.New
+func (e *UnavailableError) New(retryAfter time.Duration, message string) *UnavailableError {
+	e.HTTPCode = http.StatusServiceUnavailable
+	e.Errno = 0
+	e.Message = message
+	e.RetryAfter = retryAfter
+	return e
+}
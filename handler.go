@@ -6,8 +6,12 @@ import (
 
 // HandlersStack contains a set of handlers.
 type HandlersStack struct {
-	Handlers     []RouterHandler // The handlers stack.
-	PanicHandler RouterHandler   // The handler called in case of panic. Useful to send custom server error information. Context.Data["panic"] contains the panic error.
+	Handlers      []RouterHandler // The handlers stack.
+	PanicHandler  RouterHandler   // The handler called in case of panic. Useful to send custom server error information. Context.Data["panic"] contains the panic error.
+	ErrorReporter ErrorReporter   // The reporter of the panics, e.g. an error tracker.
+
+	requestObservers  []func(*Context) // see OnRequest
+	responseObservers []func(*Context) // see OnResponse
 }
 
 // defaultHandlersStack contains the default handlers stack used for serving.
@@ -42,10 +46,42 @@ func HandlePanic(h RouterHandler) {
 	defaultHandlersStack.HandlePanic(h)
 }
 
+// ReportErrors sets the error reporter of the handlers stack.
+func (hs *HandlersStack) ReportErrors(r ErrorReporter) {
+	hs.ErrorReporter = r
+}
+
+// ReportErrors sets the error reporter of the default handlers stack.
+func ReportErrors(r ErrorReporter) {
+	defaultHandlersStack.ReportErrors(r)
+}
+
+// OnRequest adds an observer of the requests entering the handlers stack.
+// The observers can not break the stack, their panics are logged.
+func (hs *HandlersStack) OnRequest(f func(ctx *Context)) {
+	hs.requestObservers = append(hs.requestObservers, f)
+}
+
+// OnRequest adds an observer of the requests entering the default handlers stack.
+func OnRequest(f func(ctx *Context)) {
+	defaultHandlersStack.OnRequest(f)
+}
+
+// OnResponse adds an observer of the requests leaving the handlers stack, even on panic.
+// Context.Status, Size and WrittenAt describe the response. The observers panics are logged.
+func (hs *HandlersStack) OnResponse(f func(ctx *Context)) {
+	hs.responseObservers = append(hs.responseObservers, f)
+}
+
+// OnResponse adds an observer of the requests leaving the default handlers stack.
+func OnResponse(f func(ctx *Context)) {
+	defaultHandlersStack.OnResponse(f)
+}
+
 // ServeHTTP makes a context for the request, sets some good practice default headers and enters the handlers stack.
 func (hs *HandlersStack) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Get a context for the request from ctxPool.
-	c := getContext(w, r)
+	c := getContext(hs, w, r)
 
 	// Set some "good practice" default headers.
 	c.ResponseWriter.Header().Set("Cache-Control", "no-cache")
@@ -56,11 +92,15 @@ func (hs *HandlersStack) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	c.ResponseWriter.Header().Set("Access-Control-Allow-Headers", "X-Requested-With")
 	c.ResponseWriter.Header().Set("Access-Control-Allow-Methods", "PUT,POST,GET,DELETE,OPTIONS")
 
-	// Always recover form panics.
-	defer c.Recover()
+	for _, f := range hs.requestObservers {
+		c.safely("OnRequest", func() { f(c) })
+	}
+
+	c.serve()
 
-	// Enter the handlers stack.
-	c.Next()
+	for _, f := range hs.responseObservers {
+		c.safely("OnResponse", func() { f(c) })
+	}
 
 	// Respnose data
 	// if c.written == false {
@@ -69,3 +109,20 @@ func (hs *HandlersStack) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Put the context to ctxPool
 	putContext(c)
 }
+
+// serve enters the handlers stack and renders the deferred error, it always recovers from panics.
+// The event streams left open by the handlers are closed, so that they do not write once the context is reused.
+func (ctx *Context) serve() {
+	defer ctx.Recover()
+	defer func() {
+		for _, s := range ctx.streams {
+			s.Close()
+		}
+	}()
+
+	ctx.Next()
+
+	if ctx.err != nil && ctx.Written() == false {
+		ctx.Fail(ctx.err)
+	}
+}
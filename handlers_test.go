@@ -43,3 +43,12 @@ func TestServeHTTP(t *testing.T) {
 		t.Errorf("body: want %q, got %q", bodyWant, bodyGot)
 	}
 }
+
+// performRequest serves r through a new handlers stack using the engine's router.
+func performRequest(engine *Engine, r *http.Request) *httptest.ResponseRecorder {
+	hs := NewHandlersStack()
+	hs.Use(engine.handlers)
+	w := httptest.NewRecorder()
+	hs.ServeHTTP(w, r)
+	return w
+}
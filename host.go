@@ -0,0 +1,98 @@
+package core
+
+import (
+	"strings"
+)
+
+// Host returns a router group whose routes only match requests for the host pattern.
+// Labels of the pattern starting with ':' are host params, available in Context.Params:
+//
+//	api := Routers.Host("api.example.com")
+//	tenant := Routers.Host(":tenant.example.com")
+//	tenant.GET("/", func(c *Context) { c.Ok(c.Param("tenant")) })
+//
+// Patterns are matched in registration order, after the exact hosts.
+// Requests for hosts that match no pattern are routed by the default routes.
+// The host group has the middlewares of the default engine, which must be set with Use before the first Host call,
+// every call with the same pattern returns the same group, so its middlewares apply to all its routes.
+func (engine *Engine) Host(pattern string) *RouterGroup {
+	assert1(engine.host == "", "Host must be called on the default engine")
+	pattern = strings.ToLower(pattern)
+	for _, h := range engine.hosts {
+		if h.host == pattern {
+			return &h.RouterGroup
+		}
+	}
+	for _, label := range strings.Split(pattern, ".") {
+		assert1(label != "" && label != ":", "invalid host pattern '"+pattern+"'")
+	}
+	h := &Engine{
+		RouterGroup: RouterGroup{
+			Handlers: engine.combineHandlers(nil),
+			basePath: "/",
+		},
+		trees:      make(methodTrees, 0, 9),
+		variants:   make(map[string]*routeVariants),
+		paramNames: make(map[string]string),
+		host:       pattern,
+		routeTable: engine.routeTable,
+	}
+	h.RouterGroup.engine = h
+	// Exact hosts are matched before the patterns with params.
+	i := len(engine.hosts)
+	if strings.IndexByte(pattern, ':') < 0 {
+		for i = 0; i < len(engine.hosts); i++ {
+			if strings.IndexByte(engine.hosts[i].host, ':') >= 0 {
+				break
+			}
+		}
+	}
+	engine.hosts = append(engine.hosts, nil)
+	copy(engine.hosts[i+1:], engine.hosts[i:])
+	engine.hosts[i] = h
+	return &h.RouterGroup
+}
+
+// matchHost returns the host engine matching host and the host params.
+func (engine *Engine) matchHost(host string) (*Engine, Params) {
+	host = strings.ToLower(stripPort(host))
+	labels := strings.Split(host, ".")
+	for _, h := range engine.hosts {
+		if params, ok := matchHostPattern(h.host, labels); ok {
+			return h, params
+		}
+	}
+	return nil, nil
+}
+
+func matchHostPattern(pattern string, labels []string) (Params, bool) {
+	var params Params
+	for i := 0; i < len(labels); i++ {
+		var label string
+		if j := strings.IndexByte(pattern, '.'); j >= 0 {
+			label, pattern = pattern[:j], pattern[j+1:]
+		} else if i == len(labels)-1 {
+			label, pattern = pattern, ""
+		} else {
+			return nil, false
+		}
+		if label[0] == ':' {
+			if labels[i] == "" {
+				return nil, false
+			}
+			params = append(params, Param{Key: label[1:], Value: labels[i]})
+		} else if label != labels[i] {
+			return nil, false
+		}
+	}
+	return params, pattern == ""
+}
+
+// stripPort removes the port of a host, IPv6 hosts are kept in brackets.
+func stripPort(host string) string {
+	i := strings.LastIndexByte(host, ':')
+	if i < 0 || strings.IndexByte(host[i:], ']') >= 0 {
+		return host
+	}
+	return host[:i]
+}
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestHost(t *testing.T) {
+	engine := create()
+	engine.GET("/", func(c *Context) { c.Ok("default") })
+	engine.Host(":tenant.example.com").GET("/", func(c *Context) { c.Ok(c.Param("tenant")) })
+	engine.Host("api.example.com").GET("/users/:id", func(c *Context) { c.Ok("api " + c.Param("id")) })
+
+	tests := []struct {
+		host, path string
+		code       int
+		body       string
+	}{
+		{"acme.example.com", "/", http.StatusOK, `{"ok":true,"data":"acme","message":"","errno":0}`},
+		{"ACME.example.com:8080", "/", http.StatusOK, `{"ok":true,"data":"acme","message":"","errno":0}`},
+		{"api.example.com", "/users/1", http.StatusOK, `{"ok":true,"data":"api 1","message":"","errno":0}`},
+		{"api.example.com", "/", http.StatusNotFound, ""},
+		{"a.b.example.com", "/", http.StatusOK, `{"ok":true,"data":"default","message":"","errno":0}`},
+		{"localhost", "/", http.StatusOK, `{"ok":true,"data":"default","message":"","errno":0}`},
+	}
+	for _, tt := range tests {
+		r, _ := http.NewRequest("GET", tt.path, nil)
+		r.Host = tt.host
+		w := performRequest(engine, r)
+		if w.Code != tt.code || (tt.body != "" && w.Body.String() != tt.body) {
+			t.Errorf("%s%s: want %d %s, got %d %s", tt.host, tt.path, tt.code, tt.body, w.Code, w.Body.String())
+		}
+	}
+
+	if routes := engine.Routes(); len(routes) != 3 || routes[2].Host != "api.example.com" {
+		t.Errorf("routes: got %+v", routes)
+	}
+}
+
+func TestUseAfterHost(t *testing.T) {
+	engine := create()
+	engine.Use(func(c *Context) { c.Next() })
+	engine.Host("api.example.com").Use(func(c *Context) { c.Next() })
+	defer func() {
+		if recover() == nil {
+			t.Error("want panic when Use is called on the default engine after Host")
+		}
+	}()
+	engine.Use(func(c *Context) { c.Next() })
+}
+
+func TestHostUse(t *testing.T) {
+	engine := create()
+	engine.Host("api.example.com").Use(func(c *Context) {
+		c.ResponseWriter.Header().Set("X-Api", "1")
+		c.Next()
+	})
+	engine.Host("API.example.com").GET("/", func(c *Context) { c.Ok("api") })
+	if engine.Host("api.example.com") != engine.Host("api.example.com") {
+		t.Error("want the same group for the same host")
+	}
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Host = "api.example.com"
+	w := performRequest(engine, r)
+	if w.Header().Get("X-Api") != "1" {
+		t.Errorf("want the host middleware to run, got headers %v", w.Header())
+	}
+}
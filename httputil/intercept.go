@@ -0,0 +1,217 @@
+package httputil
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/HiLittleCat/core"
+)
+
+// Interceptor configures the hooks of Intercept.
+type Interceptor struct {
+	// MaxBuffer is the size of the buffered body, default is 1MB.
+	// Beyond, or when the handlers flush, the response passes through and OnFinish is not called.
+	MaxBuffer int
+	// OnHeader is called just before the header is sent, the headers can be changed and the returned status is sent.
+	OnHeader func(c *core.Context, status int) int
+	// OnWrite is called with each write of the handlers, the returned bytes are written instead.
+	OnWrite func(c *core.Context, p []byte) []byte
+	// OnFinish is called with the buffered response when the handlers returned, the returned status and body are sent.
+	OnFinish func(c *core.Context, status int, body []byte) (int, []byte)
+}
+
+// Intercept returns a middleware buffering the responses of the next handlers, so that the hooks of i can change them.
+// E.g. adding the request id to the ResFormat responses:
+//
+//	router.Use(httputil.Intercept(httputil.Interceptor{
+//		OnFinish: func(c *core.Context, status int, body []byte) (int, []byte) {
+//			return status, append(body[:len(body)-1], `,"requestId":"`+c.Request.Header.Get("X-Request-Id")+`"}`...)
+//		},
+//	}))
+//
+// The Content-Length of a buffered response is set to the length of its final body.
+func Intercept(i Interceptor) core.RouterHandler {
+	if i.MaxBuffer <= 0 {
+		i.MaxBuffer = 1 << 20
+	}
+	return func(c *core.Context) {
+		var iw *interceptWriter
+		restore := Wrap(c, func(w http.ResponseWriter) http.ResponseWriter {
+			iw = &interceptWriter{Writer: Writer{w}, c: c, i: &i}
+			return iw
+		})
+		returned := false
+		defer func() {
+			// On panic, the buffered response is dropped so that the error can be sent, and the panic goes on.
+			if returned {
+				iw.finish()
+			} else {
+				iw.buf = nil
+			}
+			restore()
+		}()
+		c.Next()
+		returned = true
+	}
+}
+
+// interceptWriter buffers the response until the handlers returned or MaxBuffer is reached.
+type interceptWriter struct {
+	Writer
+	c           *core.Context
+	i           *Interceptor
+	status      int
+	buf         []byte
+	passthrough bool
+}
+
+func (w *interceptWriter) WriteHeader(code int) {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *interceptWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if w.i.OnWrite != nil {
+		p = w.i.OnWrite(w.c, p)
+	}
+	if w.passthrough {
+		_, err := w.ResponseWriter.Write(p)
+		return n, err
+	}
+	w.buf = append(w.buf, p...)
+	if len(w.buf) > w.i.MaxBuffer {
+		if err := w.pass(); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// Flush sends the buffered response and lets the next writes pass through.
+func (w *interceptWriter) Flush() {
+	if w.passthrough == false {
+		w.pass()
+	}
+	w.Writer.Flush()
+}
+
+// Hijack hands over the connection, the response is not intercepted anymore.
+func (w *interceptWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.passthrough = true
+	return w.Writer.Hijack()
+}
+
+// pass sends the header and the buffered body, the next writes pass through.
+func (w *interceptWriter) pass() error {
+	w.passthrough = true
+	w.writeHeader()
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+func (w *interceptWriter) writeHeader() {
+	status := w.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if w.i.OnHeader != nil {
+		status = w.i.OnHeader(w.c, status)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// finish sends the buffered response through OnFinish.
+func (w *interceptWriter) finish() {
+	if w.passthrough || w.status == 0 && len(w.buf) == 0 {
+		return
+	}
+	status, body := w.status, w.buf
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.buf = nil
+	if w.i.OnFinish != nil {
+		status, body = w.i.OnFinish(w.c, status, body)
+	}
+	h := w.Header()
+	if bodyAllowed(status) == false {
+		h.Del("Content-Length")
+		body = nil
+	} else if len(body) > 0 || w.c.Request.Method != "HEAD" {
+		h.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	w.status = status
+	w.passthrough = true
+	w.writeHeader()
+	if len(body) > 0 {
+		w.ResponseWriter.Write(body)
+	}
+}
+
+// bodyAllowed tells if a response of the status can have a body.
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// ETag returns a middleware setting a strong ETag, the hash of the body, on the successful GET responses,
+// such as the ctx.Ok responses. A 304 Not Modified is responded if the ETag matches the If-None-Match header of the request.
+// The responses having an ETag are left as is, and so are the responses larger than maxBuffer, default is 1MB.
+func ETag(maxBuffer ...int) core.RouterHandler {
+	i := Interceptor{OnFinish: func(c *core.Context, status int, body []byte) (int, []byte) {
+		h := c.ResponseWriter.Header()
+		if status != http.StatusOK || h.Get("ETag") != "" {
+			return status, body
+		}
+		sum := sha1.Sum(body)
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+		h.Set("ETag", etag)
+		if NotModified(c.Request, etag) {
+			h.Del("Content-Type")
+			return http.StatusNotModified, nil
+		}
+		return status, body
+	}}
+	if len(maxBuffer) > 0 {
+		i.MaxBuffer = maxBuffer[0]
+	}
+	intercept := Intercept(i)
+	return func(c *core.Context) {
+		if c.Request.Method != "GET" {
+			c.Next()
+			return
+		}
+		intercept(c)
+	}
+}
+
+// NotModified tells if the If-None-Match header of the request matches the etag, with the weak comparison of RFC 7232.
+func NotModified(r *http.Request, etag string) bool {
+	inm := r.Header.Get("If-None-Match")
+	if inm == "" || etag == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(inm, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package httputil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/HiLittleCat/core"
+)
+
+func serve(hs *core.HandlersStack, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	hs.ServeHTTP(w, r)
+	return w
+}
+
+func TestIntercept(t *testing.T) {
+	var finished bool
+	hs := core.NewHandlersStack()
+	hs.Use(Intercept(Interceptor{
+		MaxBuffer: 16,
+		OnHeader: func(c *core.Context, status int) int {
+			c.ResponseWriter.Header().Set("X-Status", http.StatusText(status))
+			return status
+		},
+		OnWrite: func(c *core.Context, p []byte) []byte {
+			return []byte(strings.ToUpper(string(p)))
+		},
+		OnFinish: func(c *core.Context, status int, body []byte) (int, []byte) {
+			finished = true
+			return http.StatusAccepted, append(body, "!"...)
+		},
+	}))
+	hs.Use(func(c *core.Context) {
+		c.ResponseWriter.Header().Set("Content-Length", "2")
+		c.ResponseWriter.WriteHeader(http.StatusCreated)
+		c.ResponseWriter.Write([]byte(c.Request.URL.Query().Get("body")))
+	})
+
+	r, _ := http.NewRequest("GET", "/?body=hi", nil)
+	w := serve(hs, r)
+	if w.Code != http.StatusAccepted || w.Body.String() != "HI!" {
+		t.Errorf("buffered: want 202 HI!, got %d %q", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Content-Length") != "3" || w.Header().Get("X-Status") != "Accepted" {
+		t.Errorf("buffered: want headers updated, got %v", w.Header())
+	}
+
+	finished = false
+	long := strings.Repeat("a", 20)
+	r, _ = http.NewRequest("GET", "/?body="+long, nil)
+	w = serve(hs, r)
+	if finished || w.Code != http.StatusCreated || w.Body.String() != strings.ToUpper(long) {
+		t.Errorf("passthrough: want 201 without OnFinish, got %d %q %v", w.Code, w.Body.String(), finished)
+	}
+	if w.Header().Get("X-Status") != "Created" {
+		t.Errorf("passthrough: want OnHeader called, got %v", w.Header())
+	}
+}
+
+func TestInterceptPanic(t *testing.T) {
+	hs := core.NewHandlersStack()
+	hs.Use(Intercept(Interceptor{}))
+	hs.Use(func(c *core.Context) {
+		c.ResponseWriter.Write([]byte("partial"))
+		panic("boom")
+	})
+	w := httptest.NewRecorder()
+	hs.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "partial") {
+		t.Errorf("want 500 without the buffered body, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestETag(t *testing.T) {
+	hs := core.NewHandlersStack()
+	hs.Use(ETag())
+	hs.Use(func(c *core.Context) {
+		c.Ok("hello")
+	})
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := serve(hs, r)
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatalf("want 200 with ETag, got %d %q", w.Code, etag)
+	}
+
+	r, _ = http.NewRequest("GET", "/", nil)
+	r.Header.Set("If-None-Match", `"other", W/`+etag)
+	w = serve(hs, r)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 || w.Header().Get("ETag") != etag {
+		t.Errorf("want 304 without body, got %d %q", w.Code, w.Body.String())
+	}
+
+	r, _ = http.NewRequest("POST", "/", nil)
+	r.Header.Set("If-None-Match", "*")
+	if w = serve(hs, r); w.Code != http.StatusOK || w.Header().Get("ETag") != "" {
+		t.Errorf("POST: want 200 without ETag, got %d %q", w.Code, w.Header().Get("ETag"))
+	}
+}
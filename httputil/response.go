@@ -2,53 +2,119 @@
 package httputil
 
 import (
+	"bufio"
+	"errors"
 	"io"
+	"net"
 	"net/http"
 	"reflect"
 
 	"github.com/HiLittleCat/core"
 )
 
+// Writer is the base of the response writers wrapping another one with Wrap.
+// It forwards Flush, Hijack and Push to the wrapped writer, so a writer embedding it and overriding Write keeps them.
+type Writer struct {
+	http.ResponseWriter
+}
+
+// Flush flushes the wrapped writer, if it supports it.
+func (w *Writer) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack hijacks the connection of the wrapped writer, if it supports it.
+func (w *Writer) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("the response writer does not support hijacking")
+}
+
+// Push initiates an HTTP/2 server push with the wrapped writer, if it supports it.
+func (w *Writer) Push(target string, opts *http.PushOptions) error {
+	if p, ok := w.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// Unwrap returns the wrapped writer.
+func (w *Writer) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Wrap replaces the response writer of c by the writer returned by wrap, which writes to the current one.
+// The wrappers compose: the last one set receives the writes first. The returned func restores the previous writer.
+func Wrap(c *core.Context, wrap func(w http.ResponseWriter) http.ResponseWriter) (restore func()) {
+	return c.WrapWriter(wrap)
+}
+
 // responseWriterBinder represents a binder that catches a downstream response writing and transfer its content to a writer (that will normally take care to use the original ResponseWriter).
 type responseWriterBinder struct {
-	io.Writer
-	http.ResponseWriter
+	Writer
+	dst    io.Writer
 	before []func([]byte) // A set of functions that will be triggered just before writing the response.
 }
 
 // Write calls the writer upstream after executing the functions in the before field.
-func (w responseWriterBinder) Write(p []byte) (int, error) {
+func (w *responseWriterBinder) Write(p []byte) (int, error) {
 	for _, f := range w.before {
 		f(p)
 	}
-	return w.Writer.Write(p)
+	return w.dst.Write(p)
 }
 
 // BindResponseWriter catches a downstream response writing and transfer its content to the writer w (that will normally take care to use the original ResponseWriter).
 // The before variadic is a set of functions that will be triggered just before writing the response.
 func BindResponseWriter(w io.Writer, c *core.Context, before ...func([]byte)) {
-	c.ResponseWriter = responseWriterBinder{w, c.ResponseWriter, before}
+	Wrap(c, func(rw http.ResponseWriter) http.ResponseWriter {
+		return &responseWriterBinder{Writer{rw}, w, before}
+	})
 }
 
-// ResponseStatus returns the HTTP response status.
-// Remember that the status is only set by the server after WriteHeader has been called.
+// ResponseStatus returns the HTTP response status, 0 if the header is not written yet.
+// The status is recorded by the writers of core.Context, see core.Context.Status, and the writers having an Unwrap method
+// or an exported ResponseWriter field are walked down to it, or to the writer of net/http.
+// The Code of a recorder like httptest.ResponseRecorder is returned, and 0 for the other writers.
 func ResponseStatus(w http.ResponseWriter) int {
-	return int(httpResponseStruct(reflect.ValueOf(w)).FieldByName("status").Int())
-}
-
-// httpResponseStruct returns the response structure after going trough all the intermediary response writers.
-func httpResponseStruct(v reflect.Value) reflect.Value {
-	if v.Kind() == reflect.Ptr {
-		v = v.Elem()
-	}
-
-	if v.Type().String() == "http.response" {
-		return v
+	for w != nil {
+		switch rw := w.(type) {
+		case interface{ Status() int }:
+			return rw.Status()
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+			continue
+		}
+		v := reflect.ValueOf(w)
+		if v.Kind() == reflect.Ptr {
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			return 0
+		}
+		if v.Type().String() == "http.response" {
+			if status := v.FieldByName("status"); status.Kind() == reflect.Int {
+				return int(status.Int())
+			}
+			return 0
+		}
+		if code, ok := v.Type().FieldByName("Code"); ok && code.Type.Kind() == reflect.Int && code.PkgPath == "" {
+			return int(v.FieldByIndex(code.Index).Int())
+		}
+		field, ok := v.Type().FieldByName("ResponseWriter")
+		if ok == false || field.PkgPath != "" || field.Type != responseWriterType {
+			return 0
+		}
+		w, _ = v.FieldByIndex(field.Index).Interface().(http.ResponseWriter)
 	}
-
-	return httpResponseStruct(v.FieldByName("ResponseWriter").Elem())
+	return 0
 }
 
+var responseWriterType = reflect.TypeOf((*http.ResponseWriter)(nil)).Elem()
+
 // SetDetectedContentType detects, sets and returns the response Conten-Type header value.
 func SetDetectedContentType(w http.ResponseWriter, p []byte) string {
 	ct := w.Header().Get("Content-Type")
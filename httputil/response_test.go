@@ -1,6 +1,8 @@
 package httputil
 
 import (
+	"compress/gzip"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -35,6 +37,36 @@ func TestResponseWriterBinder(t *testing.T) {
 	}
 }
 
+func TestResponseWriterBinderCompress(t *testing.T) {
+	bodyWant := "foobar"
+	var seen string
+
+	hs := core.NewHandlersStack()
+	hs.Use(core.Compress(core.CompressConfig{MinSize: 1}))
+	hs.Use(func(c *core.Context) {
+		BindResponseWriter(c.ResponseWriter, c, func(p []byte) {
+			seen = string(p)
+		})
+		c.ResponseWriter.Header().Set("Content-Type", "text/plain")
+		c.ResponseWriter.Write([]byte(bodyWant))
+	})
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	hs.ServeHTTP(w, r)
+
+	if seen != bodyWant {
+		t.Errorf("before: want %q, got %q", bodyWant, seen)
+	}
+	gr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadAll(gr); string(b) != bodyWant {
+		t.Errorf("body: want %q, got %q", bodyWant, b)
+	}
+}
+
 func TestResponseStatus(t *testing.T) {
 	statusWant := http.StatusForbidden
 	var statusGot, customStatusGot int
@@ -75,3 +107,60 @@ func TestSetDetectedContentType(t *testing.T) {
 		t.Errorf("set detected content type: want %q, got %q", headerValueWant, headerValueGot)
 	}
 }
+
+func TestResponseStatusRecorded(t *testing.T) {
+	type CustomResponseWriter struct {
+		http.ResponseWriter
+	}
+	var statusGot, customStatusGot int
+	hs := core.NewHandlersStack()
+	hs.Use(func(c *core.Context) {
+		BindResponseWriter(c.ResponseWriter, c)
+		c.Next()
+		statusGot = ResponseStatus(c.ResponseWriter)
+		customStatusGot = ResponseStatus(CustomResponseWriter{c.ResponseWriter})
+	})
+	hs.Use(func(c *core.Context) {
+		c.ResponseWriter.WriteHeader(http.StatusTeapot)
+	})
+	r, _ := http.NewRequest("GET", "/", nil)
+	hs.ServeHTTP(httptest.NewRecorder(), r)
+	if statusGot != http.StatusTeapot || customStatusGot != http.StatusTeapot {
+		t.Errorf("core writer: want %d, got %d and %d", http.StatusTeapot, statusGot, customStatusGot)
+	}
+
+	w := httptest.NewRecorder()
+	w.WriteHeader(http.StatusAccepted)
+	if got := ResponseStatus(w); got != http.StatusAccepted {
+		t.Errorf("recorder: want %d, got %d", http.StatusAccepted, got)
+	}
+}
+
+func TestWrapKeepsInterfaces(t *testing.T) {
+	type upper struct {
+		Writer
+	}
+	hs := core.NewHandlersStack()
+	hs.Use(func(c *core.Context) {
+		defer Wrap(c, func(w http.ResponseWriter) http.ResponseWriter {
+			return &upper{Writer{w}}
+		})()
+		if _, ok := c.ResponseWriter.(http.Flusher); ok == false {
+			t.Error("want Flusher")
+		}
+		if _, ok := c.ResponseWriter.(http.Hijacker); ok == false {
+			t.Error("want Hijacker")
+		}
+		if _, ok := c.ResponseWriter.(http.Pusher); ok == false {
+			t.Error("want Pusher")
+		}
+		c.ResponseWriter.Write([]byte("ok"))
+		c.ResponseWriter.(http.Flusher).Flush()
+	})
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	hs.ServeHTTP(w, r)
+	if w.Body.String() != "ok" || w.Flushed == false {
+		t.Errorf("want flushed ok, got %q %v", w.Body.String(), w.Flushed)
+	}
+}
@@ -0,0 +1,308 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/HiLittleCat/conn"
+	log "github.com/sirupsen/logrus"
+	redis "gopkg.in/redis.v5"
+)
+
+// IdempotencyStore stores the requests and the responses recorded by Idempotency.
+type IdempotencyStore interface {
+	// Add stores the value under key for ttl if the key is free, else it returns the value stored.
+	Add(key string, value []byte, ttl time.Duration) ([]byte, error)
+	// Set replaces the value of key for ttl.
+	Set(key string, value []byte, ttl time.Duration) error
+	// Delete removes key.
+	Delete(key string) error
+}
+
+// IdempotencyConfig configures the Idempotency middleware.
+type IdempotencyConfig struct {
+	Store    IdempotencyStore // default is DefaultIdempotencyStore
+	TTL      time.Duration    // lifetime of the recorded responses, default is 24 hours
+	LockTTL  time.Duration    // lifetime of the record of a request in flight, so that the key is freed if the process dies, default is 1 minute
+	Required bool             // a request without Idempotency-Key is rejected
+	MaxSize  int              // larger responses are not recorded, default is 1MB
+}
+
+// DefaultIdempotencyStore is the store of the Idempotency middlewares without store, in memory.
+var DefaultIdempotencyStore IdempotencyStore = NewMemoryIdempotencyStore()
+
+// idempotencyRecord is the request of an Idempotency-Key and its response, once done.
+type idempotencyRecord struct {
+	Fingerprint string
+	Done        bool
+	Status      int
+	Header      http.Header
+	Body        []byte
+	Truncated   bool // the body was larger than MaxSize or streamed, it is not replayed
+}
+
+// Idempotency returns a middleware making the unsafe requests having an Idempotency-Key header idempotent:
+//
+//	router.POST("/payments", core.Idempotency(core.IdempotencyConfig{Store: core.NewRedisIdempotencyStore(pool, "idem:"), Required: true}), pay)
+//
+// The first response of a key and principal is recorded and replayed for the retries, with an Idempotent-Replayed header.
+// Without principal, the keys are scoped by the remote address of the client, which is shared by all the clients
+// behind the same proxy or NAT.
+// A ConflictError is responded while the first request is in flight, and a ValidationError if the key is reused
+// for another method, path, query or body. The server errors are not recorded, so the request can be retried.
+// The responses larger than MaxSize are recorded without body, their retries are responded a ConflictError.
+func Idempotency(cfg ...IdempotencyConfig) RouterHandler {
+	var c IdempotencyConfig
+	if len(cfg) > 0 {
+		c = cfg[0]
+	}
+	if c.Store == nil {
+		c.Store = DefaultIdempotencyStore
+	}
+	if c.TTL <= 0 {
+		c.TTL = 24 * time.Hour
+	}
+	if c.LockTTL <= 0 {
+		c.LockTTL = time.Minute
+	}
+	if c.MaxSize <= 0 {
+		c.MaxSize = 1 << 20
+	}
+	return func(ctx *Context) {
+		switch ctx.Request.Method {
+		case "GET", "HEAD", "OPTIONS", "TRACE":
+			ctx.Next()
+			return
+		}
+		idemKey := ctx.Request.Header.Get("Idempotency-Key")
+		if idemKey == "" {
+			if c.Required {
+				ctx.Fail((&ValidationError{}).New("Idempotency-Key is required"))
+				return
+			}
+			ctx.Next()
+			return
+		}
+		if len(idemKey) > 255 {
+			ctx.Fail((&ValidationError{}).New("Idempotency-Key is invalid"))
+			return
+		}
+		body, err := ctx.Body()
+		if err != nil {
+			ctx.Fail(err)
+			return
+		}
+		key := idempotencyKey(ctx, idemKey)
+		fingerprint := requestFingerprint(ctx.Request, body)
+
+		pending, _ := json.Marshal(&idempotencyRecord{Fingerprint: fingerprint})
+		stored, err := c.Store.Add(key, pending, c.LockTTL)
+		if err != nil {
+			ctx.Fail(err)
+			return
+		}
+		if stored != nil {
+			rec := &idempotencyRecord{}
+			if err = json.Unmarshal(stored, rec); err != nil {
+				ctx.Fail(err)
+				return
+			}
+			rec.replay(ctx, fingerprint)
+			return
+		}
+
+		var cw *cacheWriter
+		recorded := false
+		defer func() {
+			if recorded == false {
+				if err := c.Store.Delete(key); err != nil {
+					log.WithFields(log.Fields{"key": key, "err": err}).Warnln("delete idempotency record failed")
+				}
+			}
+		}()
+		restore := ctx.WrapWriter(func(w http.ResponseWriter) http.ResponseWriter {
+			cw = &cacheWriter{ResponseWriter: w, max: c.MaxSize}
+			return cw
+		})
+		ctx.Next()
+		restore()
+		if cw.status == 0 || cw.status >= 500 {
+			return
+		}
+		rec := &idempotencyRecord{Fingerprint: fingerprint, Done: true, Status: cw.status, Header: http.Header{}, Truncated: cw.skip}
+		if cw.skip == false {
+			rec.Body = cw.buf.Bytes()
+		}
+		for k, v := range ctx.ResponseWriter.Header() {
+			rec.Header[k] = append([]string{}, v...)
+		}
+		done, err := json.Marshal(rec)
+		if err == nil {
+			err = c.Store.Set(key, done, c.TTL)
+		}
+		if err != nil {
+			log.WithFields(log.Fields{"key": key, "err": err}).Warnln("write idempotency record failed")
+			return
+		}
+		recorded = true
+	}
+}
+
+// replay responds the recorded response, or the error of a request in flight or having another fingerprint.
+func (rec *idempotencyRecord) replay(ctx *Context, fingerprint string) {
+	if rec.Fingerprint != fingerprint {
+		ctx.Fail((&ValidationError{}).New("Idempotency-Key is used by another request"))
+		return
+	}
+	if rec.Done == false {
+		ctx.ResponseWriter.Header().Set("Retry-After", "1")
+		ctx.Fail((&ConflictError{}).New("the request is in progress"))
+		return
+	}
+	if rec.Truncated {
+		ctx.Fail((&ConflictError{}).New("the request is done, its response can not be replayed"))
+		return
+	}
+	h := ctx.ResponseWriter.Header()
+	for k, v := range rec.Header {
+		h[k] = v
+	}
+	h.Set("Idempotent-Replayed", "true")
+	h.Set("Content-Length", strconv.Itoa(len(rec.Body)))
+	ctx.ResponseWriter.WriteHeader(rec.Status)
+	ctx.ResponseWriter.Write(rec.Body)
+}
+
+// idempotencyKey returns the store key of the Idempotency-Key of the principal, or of the client address without principal.
+func idempotencyKey(ctx *Context, idemKey string) string {
+	scope := "anon:" + ctx.Request.RemoteAddr
+	if host, _, err := net.SplitHostPort(ctx.Request.RemoteAddr); err == nil {
+		scope = "anon:" + host
+	}
+	if p := ctx.Principal(); p != nil {
+		scope = "principal:" + strconv.Itoa(len(p.Scheme)) + ":" + p.Scheme + p.ID
+	}
+	h := sha256.New()
+	h.Write([]byte(strconv.Itoa(len(scope)) + ":" + scope + idemKey))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// requestFingerprint returns the hash of the method, path, query and body of the request.
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.Path + "?" + r.URL.RawQuery + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// MemoryIdempotencyStore is an in-memory IdempotencyStore, the expired keys are removed while adding.
+type MemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryIdempotencyEntry
+	sweep   time.Time
+}
+
+type memoryIdempotencyEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+// NewMemoryIdempotencyStore returns an empty MemoryIdempotencyStore.
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{entries: make(map[string]memoryIdempotencyEntry)}
+}
+
+// Add stores the value of key if it is free.
+func (s *MemoryIdempotencyStore) Add(key string, value []byte, ttl time.Duration) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if now.After(s.sweep) {
+		for k, e := range s.entries {
+			if now.After(e.expires) {
+				delete(s.entries, k)
+			}
+		}
+		s.sweep = now.Add(time.Minute)
+	}
+	if e, ok := s.entries[key]; ok && now.After(e.expires) == false {
+		return e.value, nil
+	}
+	s.entries[key] = memoryIdempotencyEntry{value: value, expires: now.Add(ttl)}
+	return nil, nil
+}
+
+// Set replaces the value of key.
+func (s *MemoryIdempotencyStore) Set(key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = memoryIdempotencyEntry{value: value, expires: time.Now().Add(ttl)}
+	return nil
+}
+
+// Delete removes key.
+func (s *MemoryIdempotencyStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// RedisIdempotencyStore is an IdempotencyStore shared by the servers through redis.
+type RedisIdempotencyStore struct {
+	pool   *conn.RedisPool
+	prefix string
+}
+
+// NewRedisIdempotencyStore returns a RedisIdempotencyStore storing the keys under prefix, e.g. "idempotency:".
+func NewRedisIdempotencyStore(pool *conn.RedisPool, prefix string) *RedisIdempotencyStore {
+	return &RedisIdempotencyStore{pool: pool, prefix: prefix}
+}
+
+// Add stores the value of key with SETNX if it is free.
+func (s *RedisIdempotencyStore) Add(key string, value []byte, ttl time.Duration) ([]byte, error) {
+	var stored []byte
+	var err error
+	s.pool.Exec(func(c *redis.Client) {
+		// The stored key can expire between SETNX and GET, try again then.
+		for i := 0; i < 3; i++ {
+			var added bool
+			if added, err = c.SetNX(s.prefix+key, value, ttl).Result(); err != nil || added {
+				return
+			}
+			stored, err = c.Get(s.prefix + key).Bytes()
+			if err != redis.Nil {
+				return
+			}
+		}
+	})
+	if err == redis.Nil {
+		err = errors.New("idempotency: can not add the key " + key)
+	}
+	return stored, err
+}
+
+// Set replaces the value of key.
+func (s *RedisIdempotencyStore) Set(key string, value []byte, ttl time.Duration) error {
+	var err error
+	s.pool.Exec(func(c *redis.Client) {
+		err = c.Set(s.prefix+key, value, ttl).Err()
+	})
+	return err
+}
+
+// Delete removes key.
+func (s *RedisIdempotencyStore) Delete(key string) error {
+	var err error
+	s.pool.Exec(func(c *redis.Client) {
+		err = c.Del(s.prefix + key).Err()
+	})
+	return err
+}
@@ -0,0 +1,154 @@
+package core
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIdempotency(t *testing.T) {
+	var calls int32
+	release := make(chan struct{}, 1)
+	engine := create()
+	engine.POST("/payments", Idempotency(IdempotencyConfig{Store: NewMemoryIdempotencyStore(), Required: true}), func(c *Context) {
+		n := atomic.AddInt32(&calls, 1)
+		if c.Request.URL.Query().Get("wait") != "" {
+			<-release
+		}
+		if c.Request.URL.Query().Get("fail") != "" {
+			c.Fail((&ServerError{}).New("down"))
+			return
+		}
+		b, _ := c.Body()
+		c.ResponseWriter.Header().Set("X-Payment", string(b))
+		c.ResponseWriter.WriteHeader(http.StatusCreated)
+		c.ResponseWriter.Write([]byte("payment " + string(rune('0'+n))))
+	})
+	post := func(url, key, body string) (int, string, http.Header) {
+		r, _ := http.NewRequest("POST", url, strings.NewReader(body))
+		if key != "" {
+			r.Header.Set("Idempotency-Key", key)
+		}
+		w := performRequest(engine, r)
+		return w.Code, w.Body.String(), w.Header()
+	}
+
+	if code, _, _ := post("/payments", "", "a"); code != http.StatusBadRequest {
+		t.Errorf("no key: want 400, got %d", code)
+	}
+	code, body, _ := post("/payments", "k1", "10")
+	if code != http.StatusCreated || body != "payment 1" {
+		t.Errorf("first: want 201 payment 1, got %d %q", code, body)
+	}
+	code, body, h := post("/payments", "k1", "10")
+	if code != http.StatusCreated || body != "payment 1" || h.Get("X-Payment") != "10" || h.Get("Idempotent-Replayed") != "true" {
+		t.Errorf("retry: want replayed payment 1, got %d %q %v", code, body, h)
+	}
+	if code, _, _ := post("/payments", "k1", "20"); code != http.StatusBadRequest {
+		t.Errorf("other body: want 400, got %d", code)
+	}
+	if calls != 1 {
+		t.Errorf("want 1 call, got %d", calls)
+	}
+
+	if code, _, _ := post("/payments?fail=1", "k2", ""); code != http.StatusInternalServerError {
+		t.Errorf("failure: want 500, got %d", code)
+	}
+	if code, _, _ := post("/payments", "k2", ""); code != http.StatusCreated {
+		t.Errorf("failure not recorded: want 201 on retry, got %d", code)
+	}
+
+	done := make(chan int)
+	go func() {
+		code, _, _ := post("/payments?wait=1", "k3", "")
+		done <- code
+	}()
+	for atomic.LoadInt32(&calls) != 4 {
+		time.Sleep(time.Millisecond)
+	}
+	if code, _, h := post("/payments?wait=1", "k3", ""); code != http.StatusConflict || h.Get("Retry-After") == "" {
+		t.Errorf("in flight: want 409 with Retry-After, got %d", code)
+	}
+	release <- struct{}{}
+	if code := <-done; code != http.StatusCreated {
+		t.Errorf("in flight first: want 201, got %d", code)
+	}
+}
+
+func TestIdempotencyScope(t *testing.T) {
+	var calls int32
+	engine := create()
+	engine.POST("/orders", Idempotency(IdempotencyConfig{Store: NewMemoryIdempotencyStore()}), func(c *Context) {
+		atomic.AddInt32(&calls, 1)
+		c.Ok(nil)
+	})
+	for _, addr := range []string{"10.0.0.1:1234", "10.0.0.2:1234", "10.0.0.1:5678"} {
+		r, _ := http.NewRequest("POST", "/orders", nil)
+		r.RemoteAddr = addr
+		r.Header.Set("Idempotency-Key", "k1")
+		performRequest(engine, r)
+	}
+	if calls != 2 {
+		t.Errorf("anonymous: want the keys scoped by client address, got %d calls", calls)
+	}
+
+	key := func(id, idemKey string) string {
+		r, _ := http.NewRequest("POST", "/", nil)
+		c := &Context{Request: r, Data: map[string]interface{}{}}
+		c.SetPrincipal(&Principal{ID: id})
+		return idempotencyKey(c, idemKey)
+	}
+	if key("a", "b:c") == key("a:b", "c") {
+		t.Error("principal: want distinct keys for a + b:c and a:b + c")
+	}
+}
+
+func TestIdempotencyLockTTL(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	engine := create()
+	engine.POST("/slow", Idempotency(IdempotencyConfig{Store: NewMemoryIdempotencyStore(), LockTTL: 10 * time.Millisecond}), func(c *Context) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-release
+		}
+		c.Ok(nil)
+	})
+	post := func() int {
+		r, _ := http.NewRequest("POST", "/slow", nil)
+		r.Header.Set("Idempotency-Key", "k1")
+		return performRequest(engine, r).Code
+	}
+	go post()
+	for atomic.LoadInt32(&calls) != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if code := post(); code != http.StatusOK || calls != 2 {
+		t.Errorf("want the expired lock freed, got %d after %d calls", code, calls)
+	}
+	close(release)
+}
+
+func TestIdempotencyLargeResponse(t *testing.T) {
+	var calls int32
+	engine := create()
+	engine.POST("/exports", Idempotency(IdempotencyConfig{Store: NewMemoryIdempotencyStore(), MaxSize: 4}), func(c *Context) {
+		atomic.AddInt32(&calls, 1)
+		c.ResponseWriter.WriteHeader(http.StatusCreated)
+		c.ResponseWriter.Write([]byte("larger than the max size"))
+	})
+	post := func() int {
+		r, _ := http.NewRequest("POST", "/exports", nil)
+		r.Header.Set("Idempotency-Key", "k1")
+		return performRequest(engine, r).Code
+	}
+
+	if code := post(); code != http.StatusCreated {
+		t.Fatalf("first: want 201, got %d", code)
+	}
+	if code := post(); code != http.StatusConflict || calls != 1 {
+		t.Errorf("retry: want 409 without running the handler again, got %d after %d calls", code, calls)
+	}
+}
@@ -0,0 +1,120 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/tylerb/graceful.v1"
+)
+
+// The lifecycle events of the server, in order:
+//
+//	BeforeRun   before the flags are parsed
+//	OnInit      after the flags are parsed, before the routes are served
+//	OnStart     the listener is bound, before the first request is accepted
+//	OnShutdown  the listener is closed, while the outstanding requests are finishing
+//	OnStop      all the requests are finished, before Serve returns
+//
+// An error returned by an OnInit or OnStart hook aborts the startup.
+var (
+	initHooks     []func() error
+	startHooks    []func(addr string) error
+	shutdownHooks []func(ctx context.Context) error
+	stopHooks     []func()
+
+	// running is the server started by Serve, see Stop.
+	running   *graceful.Server
+	runningMu sync.Mutex
+)
+
+// OnInit adds a function that will be triggered after the flags are parsed, to load the config or to connect the databases.
+func OnInit(f func() error) {
+	initHooks = append(initHooks, f)
+}
+
+// OnStart adds a function that will be triggered once the listener is bound to addr, the actual address of the server.
+// With an Address like ":0", addr has the port chosen by the system.
+// The requests are accepted after all the hooks returned.
+func OnStart(f func(addr string) error) {
+	startHooks = append(startHooks, f)
+}
+
+// OnShutdown adds a function that will be triggered when the server stops listening, on SIGINT, SIGTERM or Stop.
+// The outstanding requests are finishing meanwhile, ctx is done after Timeout, when they are forcefully terminated.
+// The errors are logged.
+func OnShutdown(f func(ctx context.Context) error) {
+	shutdownHooks = append(shutdownHooks, f)
+}
+
+// OnStop adds a function that will be triggered after the server stopped and all the requests are finished,
+// to close the databases for example.
+func OnStop(f func()) {
+	stopHooks = append(stopHooks, f)
+}
+
+// Stop gracefully stops the server started by Run or Serve, as SIGINT does.
+func Stop() {
+	runningMu.Lock()
+	srv := running
+	runningMu.Unlock()
+	if srv != nil {
+		srv.Stop(Timeout)
+	}
+}
+
+func setRunning(srv *graceful.Server) {
+	runningMu.Lock()
+	running = srv
+	runningMu.Unlock()
+}
+
+// runInitHooks runs the OnInit hooks, and returns the error of the first failing one.
+func runInitHooks() error {
+	for _, f := range initHooks {
+		if err := f(); err != nil {
+			return fmt.Errorf("core: OnInit hook %s failed: %v", funcName(f), err)
+		}
+	}
+	return nil
+}
+
+// runStartHooks runs the OnStart hooks, and returns the error of the first failing one.
+func runStartHooks(addr string) error {
+	for _, f := range startHooks {
+		if err := f(addr); err != nil {
+			return fmt.Errorf("core: OnStart hook %s failed: %v", funcName(f), err)
+		}
+	}
+	return nil
+}
+
+// runShutdownHooks runs the OnShutdown hooks with a context done after Timeout.
+func runShutdownHooks() {
+	ctx := context.Background()
+	if Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, Timeout)
+		defer cancel()
+	}
+	for _, f := range shutdownHooks {
+		if err := f(ctx); err != nil {
+			log.Errorln(fmt.Sprintf("core: OnShutdown hook %s failed: %v", funcName(f), err))
+		}
+	}
+}
+
+// runStopHooks runs the OnStop hooks.
+func runStopHooks() {
+	for _, f := range stopHooks {
+		f()
+	}
+}
+
+// funcName returns the name of the function f.
+func funcName(f interface{}) string {
+	return runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
+}
@@ -0,0 +1,102 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// resetLifecycle restores the hooks and the address after a test.
+func resetLifecycle() func() {
+	address := Address
+	return func() {
+		Address = address
+		initHooks, startHooks, shutdownHooks, stopHooks = nil, nil, nil, nil
+		defaultHandlersStack.requestObservers = nil
+		defaultHandlersStack.responseObservers = nil
+	}
+}
+
+func TestServeLifecycle(t *testing.T) {
+	defer resetLifecycle()()
+	Address = "127.0.0.1:0"
+
+	var mu sync.Mutex
+	var events []string
+	event := func(e string) {
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+	}
+	Routers.GET("/lifecycle", func(c *Context) { c.Ok("up") })
+
+	OnInit(func() error { event("init"); return nil })
+	OnRequest(func(c *Context) { event("request " + c.Request.URL.Path) })
+	OnResponse(func(c *Context) { event("response " + http.StatusText(c.Status())) })
+	OnShutdown(func(ctx context.Context) error {
+		if _, ok := ctx.Deadline(); ok == false {
+			t.Error("OnShutdown: want a context with a deadline")
+		}
+		event("shutdown")
+		return nil
+	})
+	OnStop(func() { event("stop") })
+
+	var body string
+	OnStart(func(addr string) error {
+		event("start")
+		if strings.HasSuffix(addr, ":0") {
+			t.Errorf("OnStart: want the actual address, got %s", addr)
+		}
+		go func() {
+			defer Stop()
+			res, err := http.Get("http://" + addr + "/lifecycle")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			b, _ := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			body = string(b)
+		}()
+		return nil
+	})
+
+	if err := Serve(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(body, "up") == false {
+		t.Errorf("want the route response, got %q", body)
+	}
+	want := "init,start,request /lifecycle,response OK,shutdown,stop"
+	if got := strings.Join(events, ","); got != want {
+		t.Errorf("want events %s, got %s", want, got)
+	}
+}
+
+func TestServeHookError(t *testing.T) {
+	defer resetLifecycle()()
+	Address = "127.0.0.1:0"
+
+	var started, stopped bool
+	OnInit(func() error { return errors.New("config not found") })
+	OnStart(func(string) error { started = true; return nil })
+	OnStop(func() { stopped = true })
+	err := Serve()
+	if err == nil || strings.Contains(err.Error(), "OnInit") == false || strings.Contains(err.Error(), "config not found") == false {
+		t.Errorf("OnInit: want the hook error, got %v", err)
+	}
+	if started || stopped {
+		t.Errorf("OnInit: want startup aborted, got started %t, stopped %t", started, stopped)
+	}
+
+	initHooks = nil
+	OnStart(func(string) error { return errors.New("port not registered") })
+	if err = Serve(); err == nil || strings.Contains(err.Error(), "OnStart") == false {
+		t.Errorf("OnStart: want the hook error, got %v", err)
+	}
+}
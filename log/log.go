@@ -2,6 +2,7 @@
 package log
 
 import (
+	"bytes"
 	"log"
 	"runtime"
 	"strings"
@@ -32,7 +33,107 @@ func callerPackage() (pack string, ok bool) {
 	if pc, _, _, ok = runtime.Caller(2); !ok {
 		return
 	}
-	path := strings.Split(runtime.FuncForPC(pc).Name(), "/")
-	pack = strings.Split(path[len(path)-1], ".")[0]
+	pack = packageName(runtime.FuncForPC(pc).Name())
 	return
 }
+
+// packageName returns the name of the package of a function, e.g. "core" for "github.com/HiLittleCat/core.(*Context).Next".
+func packageName(funcName string) string {
+	path := strings.Split(funcName, "/")
+	return strings.Split(path[len(path)-1], ".")[0]
+}
+
+// packagePath returns the import path of the package of a function.
+func packagePath(funcName string) string {
+	slash := strings.LastIndex(funcName, "/")
+	dot := strings.Index(funcName[slash+1:], ".")
+	if dot < 0 {
+		return funcName
+	}
+	return funcName[:slash+1+dot]
+}
+
+// stackFrame is a frame of a runtime.Stack trace: the function line and the file line.
+type stackFrame struct {
+	function, file string
+}
+
+// funcName returns the name of the function of the frame, without the arguments.
+func (f stackFrame) funcName() string {
+	name := strings.TrimPrefix(f.function, "created by ")
+	if i := strings.Index(name, " in goroutine "); i >= 0 {
+		name = name[:i]
+	}
+	if strings.HasSuffix(name, ")") {
+		if i := strings.LastIndex(name, "("); i > 0 {
+			name = name[:i]
+		}
+	}
+	return name
+}
+
+// parseStack splits a runtime.Stack trace of one goroutine into its header and its frames.
+func parseStack(stack []byte) (string, []stackFrame) {
+	lines := strings.Split(strings.TrimRight(string(stack), "\n"), "\n")
+	var frames []stackFrame
+	for i := 1; i < len(lines); i++ {
+		f := stackFrame{function: lines[i]}
+		if i+1 < len(lines) && strings.HasPrefix(lines[i+1], "\t") {
+			i++
+			f.file = lines[i]
+		}
+		frames = append(frames, f)
+	}
+	return lines[0], frames
+}
+
+// TrimStack removes the frames of the panic and of the packages from a runtime.Stack trace, e.g. the frames of
+// the runtime, of net/http and of the framework, so that the frames of the application stand out.
+// The stack is returned as is if no frame would be left.
+func TrimStack(stack []byte, packages ...string) []byte {
+	header, frames := parseStack(stack)
+	var b bytes.Buffer
+	b.WriteString(header + "\n")
+	kept := 0
+	for _, f := range frames {
+		name := f.funcName()
+		if name == "panic" || inStrings(packages, packagePath(name)) {
+			continue
+		}
+		kept++
+		b.WriteString(f.function + "\n")
+		if f.file != "" {
+			b.WriteString(f.file + "\n")
+		}
+	}
+	if kept == 0 {
+		return stack
+	}
+	return b.Bytes()
+}
+
+// PanicPackage returns the name of the package of the function that panicked, from a runtime.Stack trace taken
+// while recovering, or "" if the stack has no panic.
+func PanicPackage(stack []byte) string {
+	_, frames := parseStack(stack)
+	for i, f := range frames {
+		if f.funcName() != "panic" {
+			continue
+		}
+		for _, caller := range frames[i+1:] {
+			if name := caller.funcName(); packagePath(name) != "runtime" {
+				return packageName(name)
+			}
+		}
+	}
+	return ""
+}
+
+func inStrings(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
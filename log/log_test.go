@@ -0,0 +1,47 @@
+package log
+
+import (
+	"testing"
+)
+
+const testStack = `goroutine 7 [running]:
+github.com/HiLittleCat/core.(*Context).Recover(0xc000180000)
+	/src/core/context.go:290 +0x65
+panic({0x6b2e40, 0x7f5c10})
+	/usr/local/go/src/runtime/panic.go:770 +0x132
+example.com/app/users.(*Service).Find(0x0)
+	/src/app/users/service.go:12 +0x1d
+example.com/app/users.Handler(0xc000180000)
+	/src/app/users/handler.go:20 +0x2a
+github.com/HiLittleCat/core.(*Context).Next(0xc000180000)
+	/src/core/context.go:151 +0x42
+net/http.serverHandler.ServeHTTP({0xc0000a8000}, {0x7f6a38, 0xc0000c2000}, 0xc0000c6000)
+	/usr/local/go/src/net/http/server.go:3137 +0x8e
+created by net/http.(*Server).Serve in goroutine 1
+	/usr/local/go/src/net/http/server.go:3285 +0x4b4
+`
+
+func TestTrimStack(t *testing.T) {
+	got := string(TrimStack([]byte(testStack), "runtime", "net/http", "github.com/HiLittleCat/core"))
+	want := `goroutine 7 [running]:
+example.com/app/users.(*Service).Find(0x0)
+	/src/app/users/service.go:12 +0x1d
+example.com/app/users.Handler(0xc000180000)
+	/src/app/users/handler.go:20 +0x2a
+`
+	if got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+	if got := string(TrimStack([]byte(testStack), "example.com/app/users", "github.com/HiLittleCat/core", "net/http")); got != testStack {
+		t.Errorf("want the stack as is when no frame is left, got %s", got)
+	}
+}
+
+func TestPanicPackage(t *testing.T) {
+	if got := PanicPackage([]byte(testStack)); got != "users" {
+		t.Errorf("want users, got %q", got)
+	}
+	if got := PanicPackage([]byte("goroutine 1 [running]:\nmain.main()\n\t/src/main.go:3 +0x1\n")); got != "" {
+		t.Errorf("want no panic package, got %q", got)
+	}
+}
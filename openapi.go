@@ -0,0 +1,536 @@
+package core
+
+import (
+	"encoding/json"
+	"html"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RouteDoc documents a route for the OpenAPI generator, see Doc.
+type RouteDoc struct {
+	Summary     string
+	Description string
+	Tags        []string
+	Request     interface{}  // bound model, the request body of POST, PUT and PATCH, the query of the other methods
+	Response    interface{}  // data of the ResFormat response
+	Errors      []ICoreError // error responses, e.g. (&NotFoundError{}).New("user not found")
+	Deprecated  bool
+	Hidden      bool // exclude the route from the document
+}
+
+// Doc documents the routes.
+// The request and response types of the handlers registered with RouterGroup.Typed are kept if the doc does not set them.
+//
+//	router.POST("/users", handler).Doc(core.RouteDoc{Request: &UserForm{}, Response: &User{}})
+func (r *Route) Doc(doc RouteDoc) *Route {
+	assert1(len(r.routes) > 0, "no route to document")
+	for _, info := range r.routes {
+		d := doc
+		if info.Doc != nil && d.Request == nil {
+			d.Request = info.Doc.Request
+		}
+		if info.Doc != nil && d.Response == nil {
+			d.Response = info.Doc.Response
+		}
+		info.Doc = &d
+	}
+	return r
+}
+
+// ServeOpenAPI serves the OpenAPI document of the routes at /openapi.json, and a Swagger UI at /swagger if ui is true, see SwaggerUI.
+// The host and version query params select the routes of a host and an api version, see OpenAPIConfig.
+// The document is generated on the first request, so routes registered after ServeOpenAPI are documented too.
+func (engine *Engine) ServeOpenAPI(title, version string, ui bool) {
+	var (
+		once sync.Once
+		spec []byte
+	)
+	engine.GET("/openapi.json", func(ctx *Context) {
+		query := ctx.Request.URL.Query()
+		cfg := OpenAPIConfig{Host: query.Get("host"), Version: query.Get("version")}
+		once.Do(func() {
+			spec, _ = json.Marshal(engine.OpenAPI(title, version))
+		})
+		b := spec
+		if cfg != (OpenAPIConfig{}) {
+			b, _ = json.Marshal(engine.OpenAPI(title, version, cfg))
+		}
+		ctx.ResponseWriter.Header().Set("Content-Type", "application/json")
+		ctx.ResponseWriter.WriteHeader(http.StatusOK)
+		ctx.ResponseWriter.Write(b)
+	}).Doc(RouteDoc{Hidden: true})
+	if ui == false {
+		return
+	}
+	cfg := SwaggerUI
+	selfHosted := strings.HasPrefix(cfg.BaseURL, "/") && strings.HasPrefix(cfg.BaseURL, "//") == false
+	assert1(cfg.Assets != nil || selfHosted || (cfg.BaseURL != "" && cfg.CSSIntegrity != "" && cfg.JSIntegrity != ""),
+		"SwaggerUI needs Assets, a self-hosted BaseURL or the integrity of the files at BaseURL")
+	base := cfg.BaseURL
+	if cfg.Assets != nil {
+		base = "swagger-ui"
+		engine.StaticFS("/swagger-ui", cfg.Assets).Doc(RouteDoc{Hidden: true})
+	}
+	page := []byte(swaggerUIPage(base, cfg))
+	engine.GET("/swagger", func(ctx *Context) {
+		ctx.ResponseWriter.Header().Set("Content-Type", "text/html; charset=utf-8")
+		ctx.ResponseWriter.WriteHeader(http.StatusOK)
+		ctx.ResponseWriter.Write(page)
+	}).Doc(RouteDoc{Hidden: true})
+}
+
+// SwaggerUIConfig locates the swagger-ui-dist files of the Swagger UI served by ServeOpenAPI.
+// A BaseURL on another origin needs the integrity of both files, a path on the same origin like "/static/swagger-ui" does not.
+type SwaggerUIConfig struct {
+	BaseURL      string          // URL of the swagger-ui-dist files, at an exact version
+	CSSIntegrity string          // subresource integrity of swagger-ui.css, e.g. "sha384-..."
+	JSIntegrity  string          // subresource integrity of swagger-ui-bundle.js
+	Assets       http.FileSystem // swagger-ui-dist files served at /swagger-ui/ instead of BaseURL, to self-host the UI
+}
+
+// SwaggerUI is the config of the Swagger UI, it must be set before ServeOpenAPI serves the UI:
+//
+//	core.SwaggerUI = core.SwaggerUIConfig{Assets: http.Dir("node_modules/swagger-ui-dist")}
+//	core.SwaggerUI = core.SwaggerUIConfig{
+//		BaseURL:      "https://unpkg.com/swagger-ui-dist@5.17.14",
+//		CSSIntegrity: "sha384-...",
+//		JSIntegrity:  "sha384-...",
+//	}
+var SwaggerUI SwaggerUIConfig
+
+// swaggerUIPage returns the page of the Swagger UI loading the files at base.
+func swaggerUIPage(base string, cfg SwaggerUIConfig) string {
+	integrity := func(sri string) string {
+		if sri == "" {
+			return ""
+		}
+		return ` integrity="` + html.EscapeString(sri) + `" crossorigin="anonymous"`
+	}
+	base = html.EscapeString(strings.TrimSuffix(base, "/"))
+	return `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>API</title>
+<link rel="stylesheet" href="` + base + `/swagger-ui.css"` + integrity(cfg.CSSIntegrity) + `>
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="` + base + `/swagger-ui-bundle.js"` + integrity(cfg.JSIntegrity) + `></script>
+<script>window.ui = SwaggerUIBundle({url: "openapi.json", dom_id: "#swagger-ui"});</script>
+</body>
+</html>`
+}
+
+// OpenAPIConfig selects the routes of an OpenAPI document, since a path can only be documented once.
+type OpenAPIConfig struct {
+	Host    string // host pattern of the routes given to Host, empty for the default routes
+	Version string // api version of the routes registered by several versions, default is the latest one
+}
+
+// OpenAPI generates an OpenAPI 3.1 document of the routes.
+// It documents the default routes, and the latest version of the versioned ones, unless cfg selects others.
+func (engine *Engine) OpenAPI(title, version string, cfg ...OpenAPIConfig) H {
+	var c OpenAPIConfig
+	if len(cfg) > 0 {
+		c = cfg[0]
+	}
+	c.Host = strings.ToLower(c.Host)
+	c.Version = strings.TrimPrefix(c.Version, "v")
+
+	// Keep one route by method and path, the closest version to c.Version.
+	var routes []*RouteInfo
+	index := map[string]int{}
+	for _, r := range engine.routes {
+		if (r.Doc != nil && r.Doc.Hidden) || r.Host != c.Host {
+			continue
+		}
+		if c.Version != "" && r.Version != "" && compareVersions(r.Version, c.Version) > 0 {
+			continue
+		}
+		key := r.Method + " " + r.Path
+		if i, ok := index[key]; ok == false {
+			index[key] = len(routes)
+			routes = append(routes, r)
+		} else if compareVersions(r.Version, routes[i].Version) > 0 {
+			routes[i] = r
+		}
+	}
+
+	g := &openAPIGenerator{schemas: H{}, types: map[string]reflect.Type{}}
+	paths := H{}
+	for _, r := range routes {
+		path, params := openAPIPath(r.Path)
+		item, ok := paths[path].(H)
+		if ok == false {
+			item = H{}
+			paths[path] = item
+		}
+		item[strings.ToLower(r.Method)] = g.operation(r, params)
+	}
+	return H{
+		"openapi":    "3.1.0",
+		"info":       H{"title": title, "version": version},
+		"paths":      paths,
+		"components": H{"schemas": g.schemas},
+	}
+}
+
+// openAPIPath converts /users/:id/*file to /users/{id}/{file} and returns the params.
+func openAPIPath(path string) (string, []string) {
+	segments := strings.Split(path, "/")
+	var params []string
+	for i, s := range segments {
+		if len(s) > 1 && (s[0] == ':' || s[0] == '*') {
+			params = append(params, s[1:])
+			segments[i] = "{" + s[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+type openAPIGenerator struct {
+	schemas H
+	types   map[string]reflect.Type
+}
+
+func (g *openAPIGenerator) operation(r *RouteInfo, pathParams []string) H {
+	doc := r.Doc
+	if doc == nil {
+		doc = &RouteDoc{}
+	}
+	op := H{"operationId": r.Method + " " + r.Path}
+	if r.Name != "" {
+		op["operationId"] = r.Name
+	}
+	if doc.Summary != "" {
+		op["summary"] = doc.Summary
+	}
+	if doc.Description != "" {
+		op["description"] = doc.Description
+	}
+	if len(doc.Tags) > 0 {
+		op["tags"] = doc.Tags
+	}
+	if doc.Deprecated {
+		op["deprecated"] = true
+	}
+
+	params := []H{}
+	for _, p := range pathParams {
+		params = append(params, H{"name": p, "in": "path", "required": true, "schema": constraintSchema(r.Constraints[p])})
+	}
+	if doc.Request != nil {
+		switch r.Method {
+		case "POST", "PUT", "PATCH":
+			op["requestBody"] = H{
+				"required": true,
+				"content":  H{"application/json": H{"schema": g.schema(reflect.TypeOf(doc.Request))}},
+			}
+		default:
+			params = append(params, g.queryParams(reflect.TypeOf(doc.Request))...)
+		}
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+
+	var data H
+	if doc.Response != nil {
+		data = g.schema(reflect.TypeOf(doc.Response))
+	}
+	responses := H{"200": H{"description": "OK", "content": resFormatContent(true, data)}}
+	for _, e := range doc.Errors {
+		code := strconv.Itoa(e.GetHTTPCode())
+		desc := reflect.Indirect(reflect.ValueOf(e)).Type().Name()
+		if e.Error() != "" {
+			desc += ": " + e.Error()
+		}
+		if prev, ok := responses[code].(H); ok {
+			desc = prev["description"].(string) + "; " + desc
+		}
+		responses[code] = H{"description": desc, "content": resFormatContent(false, nil)}
+	}
+	if _, ok := responses["500"]; ok == false {
+		responses["default"] = H{"description": "ServerError", "content": resFormatContent(false, nil)}
+	}
+	op["responses"] = responses
+	return op
+}
+
+// constraintSchema returns the schema of a path param constraint.
+func constraintSchema(spec string) H {
+	switch spec {
+	case "int":
+		return H{"type": "integer"}
+	case "uint":
+		return H{"type": "integer", "minimum": 0}
+	case "float":
+		return H{"type": "number"}
+	case "bool":
+		return H{"type": "boolean"}
+	case "alpha":
+		return H{"type": "string", "pattern": "^[a-zA-Z]+$"}
+	case "alnum":
+		return H{"type": "string", "pattern": "^[a-zA-Z0-9]+$"}
+	case "uuid":
+		return H{"type": "string", "format": "uuid"}
+	}
+	if strings.HasPrefix(spec, "regex:") {
+		return H{"type": "string", "pattern": "^(?:" + spec[6:] + ")$"}
+	}
+	return H{"type": "string"}
+}
+
+// resFormatContent wraps data into the ResFormat schema.
+func resFormatContent(ok bool, data H) H {
+	props := H{
+		"ok":      H{"type": "boolean", "const": ok},
+		"message": H{"type": "string"},
+		"errno":   H{"type": "integer"},
+	}
+	if data != nil {
+		props["data"] = data
+	} else {
+		props["data"] = H{"type": "null"}
+	}
+	if ok == false {
+		props["errorId"] = H{"type": "string"}
+	}
+	return H{"application/json": H{"schema": H{
+		"type":       "object",
+		"properties": props,
+		"required":   []string{"ok", "data", "message", "errno"},
+	}}}
+}
+
+func (g *openAPIGenerator) queryParams(t reflect.Type) []H {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	var params []H
+	if t.Kind() != reflect.Struct {
+		return params
+	}
+	for _, f := range structFields(t) {
+		p := H{"name": f.name, "in": "query", "schema": g.fieldSchema(f)}
+		if f.required {
+			p["required"] = true
+		}
+		params = append(params, p)
+	}
+	return params
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schema returns the JSON schema of t, structs are added to the components and referenced.
+func (g *openAPIGenerator) schema(t reflect.Type) H {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return H{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return H{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return H{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return H{"type": "number"}
+	case reflect.String:
+		return H{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return H{"type": "string", "contentEncoding": "base64"}
+		}
+		return H{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return H{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		name := t.Name()
+		if other, ok := g.types[name]; ok && other != t {
+			name = strings.Replace(t.String(), ".", "_", -1)
+		}
+		if _, ok := g.types[name]; ok == false {
+			g.types[name] = t
+			g.schemas[name] = H{} // placeholder for recursive types
+			g.schemas[name] = g.structSchema(t)
+		}
+		return H{"$ref": "#/components/schemas/" + name}
+	}
+	return H{}
+}
+
+func (g *openAPIGenerator) structSchema(t reflect.Type) H {
+	props := H{}
+	required := []string{}
+	for _, f := range structFields(t) {
+		props[f.name] = g.fieldSchema(f)
+		if f.required {
+			required = append(required, f.name)
+		}
+	}
+	s := H{"type": "object", "properties": props}
+	if len(required) > 0 {
+		sort.Strings(required)
+		s["required"] = required
+	}
+	return s
+}
+
+// fieldSchema returns the schema of a field with the constraints of its validate and default tags.
+func (g *openAPIGenerator) fieldSchema(f modelField) H {
+	s := g.schema(f.Type)
+	if _, ref := s["$ref"]; ref {
+		return s
+	}
+	kind := f.Type.Kind()
+	if kind == reflect.Ptr {
+		kind = f.Type.Elem().Kind()
+	}
+	for _, rule := range strings.Split(f.Tag.Get("validate"), ",") {
+		name, arg := rule, ""
+		if i := strings.IndexByte(rule, '='); i > 0 {
+			name, arg = rule[:i], rule[i+1:]
+		}
+		switch name {
+		case "email":
+			s["format"] = "email"
+		case "url", "uri":
+			s["format"] = "uri"
+		case "uuid", "uuid4":
+			s["format"] = "uuid"
+		case "ip", "ipv4":
+			s["format"] = "ipv4"
+		case "oneof":
+			enum := []interface{}{}
+			for _, v := range strings.Fields(arg) {
+				enum = append(enum, tagValue(kind, v))
+			}
+			s["enum"] = enum
+		case "min", "max", "len", "gte", "lte", "gt", "lt":
+			n, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				continue
+			}
+			for _, key := range constraintKeys(kind, name) {
+				s[key] = n
+			}
+		}
+	}
+	if d := f.Tag.Get("default"); d != "" {
+		s["default"] = tagValue(kind, d)
+	}
+	return s
+}
+
+// constraintKeys maps a validator constraint to the JSON schema keywords of the kind.
+func constraintKeys(kind reflect.Kind, rule string) []string {
+	prefix := ""
+	switch kind {
+	case reflect.String:
+		prefix = "Length"
+	case reflect.Slice, reflect.Array:
+		prefix = "Items"
+	case reflect.Map:
+		prefix = "Properties"
+	}
+	if prefix != "" {
+		switch rule {
+		case "min", "gte":
+			return []string{"min" + prefix}
+		case "max", "lte":
+			return []string{"max" + prefix}
+		case "len":
+			return []string{"min" + prefix, "max" + prefix}
+		}
+		return nil
+	}
+	switch rule {
+	case "min", "gte":
+		return []string{"minimum"}
+	case "max", "lte":
+		return []string{"maximum"}
+	case "gt":
+		return []string{"exclusiveMinimum"}
+	case "lt":
+		return []string{"exclusiveMaximum"}
+	}
+	return nil
+}
+
+// tagValue converts a tag value to the type of the kind.
+func tagValue(kind reflect.Kind, v string) interface{} {
+	switch kind {
+	case reflect.Bool:
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return n
+		}
+	case reflect.Float32, reflect.Float64:
+		if n, err := strconv.ParseFloat(v, 64); err == nil {
+			return n
+		}
+	}
+	return v
+}
+
+// modelField is an exported field of a model with its json name.
+type modelField struct {
+	reflect.StructField
+	name     string
+	required bool
+}
+
+// structFields returns the json fields of t, embedded structs without json name are flattened.
+func structFields(t reflect.Type) []modelField {
+	var fields []modelField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				fields = append(fields, structFields(ft)...)
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		required := false
+		for _, rule := range strings.Split(f.Tag.Get("validate"), ",") {
+			if rule == "required" {
+				required = true
+			}
+		}
+		fields = append(fields, modelField{StructField: f, name: name, required: required})
+	}
+	return fields
+}
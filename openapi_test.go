@@ -0,0 +1,158 @@
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type userForm struct {
+	Model
+	Name  string `json:"name" validate:"required,min=2,max=20"`
+	Email string `json:"email" validate:"required,email"`
+	Age   int    `json:"age" validate:"gte=0,lte=150" default:"18"`
+	Role  string `json:"role" validate:"oneof=admin user" default:"user"`
+}
+
+type user struct {
+	ID      int      `json:"id"`
+	Name    string   `json:"name"`
+	Friends []*user  `json:"friends"`
+	Tags    []string `json:"tags,omitempty"`
+}
+
+func TestOpenAPI(t *testing.T) {
+	engine := create()
+	engine.POST("/users", showUser).Name("user.create").Doc(RouteDoc{
+		Request:  &userForm{},
+		Response: &user{},
+		Errors:   []ICoreError{(&ValidationError{}).New("")},
+	})
+	engine.GET("/users/:id/*file", showUser)
+	engine.ServeOpenAPI("test", "1.0", false)
+
+	r, _ := http.NewRequest("GET", "/openapi.json", nil)
+	w := performRequest(engine, r)
+	var spec struct {
+		OpenAPI    string
+		Paths      map[string]map[string]json.RawMessage
+		Components struct{ Schemas map[string]json.RawMessage }
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &spec); err != nil {
+		t.Fatal(err, w.Body.String())
+	}
+	if spec.OpenAPI != "3.1.0" {
+		t.Errorf("openapi: got %q", spec.OpenAPI)
+	}
+	if _, ok := spec.Paths["/openapi.json"]; ok {
+		t.Error("hidden route is documented")
+	}
+	create := string(spec.Paths["/users"]["post"])
+	for _, want := range []string{`"operationId":"user.create"`, `"#/components/schemas/userForm"`, `"400"`, `"#/components/schemas/user"`} {
+		if strings.Contains(create, want) == false {
+			t.Errorf("post /users: %s not found in %s", want, create)
+		}
+	}
+	get := string(spec.Paths["/users/{id}/{file}"]["get"])
+	if strings.Contains(get, `"name":"file","required":true`) == false {
+		t.Errorf("get /users/{id}/{file}: params not found in %s", get)
+	}
+	form := string(spec.Components.Schemas["userForm"])
+	for _, want := range []string{`"minLength":2`, `"format":"email"`, `"maximum":150`, `"default":18`, `"enum":["admin","user"]`, `"required":["email","name"]`} {
+		if strings.Contains(form, want) == false {
+			t.Errorf("userForm: %s not found in %s", want, form)
+		}
+	}
+	if strings.Contains(string(spec.Components.Schemas["user"]), `"items":{"$ref":"#/components/schemas/user"}`) == false {
+		t.Errorf("user: recursive ref not found in %s", spec.Components.Schemas["user"])
+	}
+	if strings.Contains(create, `"errorId":{"type":"string"}`) == false {
+		t.Errorf("post /users: errorId not found in %s", create)
+	}
+}
+
+func TestOpenAPIScopes(t *testing.T) {
+	engine := create()
+	engine.GET("/users", showUser).Doc(RouteDoc{Summary: "default"})
+	engine.Host("api.example.com").GET("/users", showUser).Doc(RouteDoc{Summary: "api"})
+	vs := engine.Group("/v").Versioned(VersionConfig{})
+	vs.Version("1").GET("/items", showUser).Doc(RouteDoc{Summary: "v1"})
+	vs.Version("2").GET("/items", showUser).Doc(RouteDoc{Summary: "v2"})
+	vs.Version("3").GET("/items", showUser).Doc(RouteDoc{Summary: "v3"})
+	engine.ServeOpenAPI("test", "1.0", false)
+
+	for _, tt := range []struct {
+		query, path, want string
+	}{
+		{"", "/users", "default"},
+		{"", "/v/items", "v3"},
+		{"?version=2", "/v/items", "v2"},
+		{"?version=v2.5", "/v/items", "v2"},
+		{"?host=api.example.com", "/users", "api"},
+	} {
+		var spec struct {
+			Paths map[string]map[string]struct{ Summary string }
+		}
+		w := performRequest(engine, httptest.NewRequest("GET", "/openapi.json"+tt.query, nil))
+		if err := json.Unmarshal(w.Body.Bytes(), &spec); err != nil {
+			t.Fatal(err, w.Body.String())
+		}
+		if got := spec.Paths[tt.path]["get"].Summary; got != tt.want {
+			t.Errorf("%s %s: want %q, got %q", tt.query, tt.path, tt.want, got)
+		}
+	}
+}
+
+func TestSwaggerUI(t *testing.T) {
+	defer func(cfg SwaggerUIConfig) { SwaggerUI = cfg }(SwaggerUI)
+	dir, err := ioutil.TempDir("", "swagger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "swagger-ui.css"), []byte("body{}"), 0644)
+
+	for _, cfg := range []SwaggerUIConfig{{}, {BaseURL: "https://cdn.example.com/swagger-ui-dist@5.17.14", JSIntegrity: "sha384-abc"}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%+v: want panic without integrity", cfg)
+				}
+			}()
+			SwaggerUI = cfg
+			create().ServeOpenAPI("test", "1.0", true)
+		}()
+	}
+
+	SwaggerUI = SwaggerUIConfig{BaseURL: "https://cdn.example.com/swagger-ui-dist@5.17.14/", CSSIntegrity: "sha384-css", JSIntegrity: "sha384-abc"}
+	engine := create()
+	engine.ServeOpenAPI("test", "1.0", true)
+	page := performRequest(engine, httptest.NewRequest("GET", "/swagger", nil)).Body.String()
+	for _, want := range []string{`href="https://cdn.example.com/swagger-ui-dist@5.17.14/swagger-ui.css" integrity="sha384-css" crossorigin="anonymous">`, `swagger-ui-bundle.js" integrity="sha384-abc" crossorigin="anonymous">`} {
+		if strings.Contains(page, want) == false {
+			t.Errorf("cdn: %s not found in %s", want, page)
+		}
+	}
+
+	SwaggerUI = SwaggerUIConfig{BaseURL: "/static/swagger-ui"}
+	engine = create()
+	engine.ServeOpenAPI("test", "1.0", true)
+	if page = performRequest(engine, httptest.NewRequest("GET", "/swagger", nil)).Body.String(); strings.Contains(page, `href="/static/swagger-ui/swagger-ui.css">`) == false {
+		t.Errorf("self-hosted: want the local url, got %s", page)
+	}
+
+	SwaggerUI = SwaggerUIConfig{Assets: http.Dir(dir)}
+	engine = create()
+	engine.ServeOpenAPI("test", "1.0", true)
+	if page = performRequest(engine, httptest.NewRequest("GET", "/swagger", nil)).Body.String(); strings.Contains(page, `href="swagger-ui/swagger-ui.css"`) == false {
+		t.Errorf("assets: want the local files, got %s", page)
+	}
+	if w := performRequest(engine, httptest.NewRequest("GET", "/swagger-ui/swagger-ui.css", nil)); w.Code != http.StatusOK || w.Body.String() != "body{}" {
+		t.Errorf("assets: want the css served, got %d %q", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,191 @@
+package core
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// paramConstraints maps a constraint name to its check, see RegisterParamConstraint.
+var paramConstraints = map[string]func(string) bool{
+	"int": func(v string) bool {
+		_, err := strconv.ParseInt(v, 10, 64)
+		return err == nil
+	},
+	"uint": func(v string) bool {
+		_, err := strconv.ParseUint(v, 10, 64)
+		return err == nil
+	},
+	"float": func(v string) bool {
+		_, err := strconv.ParseFloat(v, 64)
+		return err == nil
+	},
+	"bool": func(v string) bool {
+		_, err := strconv.ParseBool(v)
+		return err == nil
+	},
+	"alpha": regexp.MustCompile(`^[a-zA-Z]+$`).MatchString,
+	"alnum": regexp.MustCompile(`^[a-zA-Z0-9]+$`).MatchString,
+	"uuid":  uuidPattern.MatchString,
+}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// RegisterParamConstraint registers a path param constraint usable as /path/:name<constraint>.
+// Builtin constraints are int, uint, float, bool, alpha, alnum, uuid and regex:<pattern>.
+func RegisterParamConstraint(name string, check func(string) bool) {
+	paramConstraints[name] = check
+}
+
+// paramConstraint is a constraint of a path param.
+type paramConstraint struct {
+	param string
+	spec  string
+	check func(string) bool
+}
+
+// routeVariant is one of the routes registered on the same tree path with different constraints.
+type routeVariant struct {
+	constraints []paramConstraint
+	handlers    RouterHandlerChain
+	renames     map[string]string // names of the route's params by their names in the tree, see canonicalParams
+}
+
+// routeVariants are tried in order, constrained routes first.
+type routeVariants []*routeVariant
+
+// match returns the first variant whose constraints all pass.
+func (vs routeVariants) match(params Params) *routeVariant {
+	for _, v := range vs {
+		ok := true
+		for _, c := range v.constraints {
+			if c.check(params.ByName(c.param)) == false {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return v
+		}
+	}
+	return nil
+}
+
+// dispatch returns the handlers stored in the tree for paths having several variants.
+func (vs *routeVariants) dispatch() RouterHandlerChain {
+	return RouterHandlerChain{func(ctx *Context) {
+		v := vs.match(ctx.Params)
+		if v == nil {
+			ctx.Fail((&NotFoundError{}).New("Url Not found"))
+			return
+		}
+		if v.renames != nil {
+			params := make(Params, len(ctx.Params))
+			for i, p := range ctx.Params {
+				if name, ok := v.renames[p.Key]; ok {
+					p.Key = name
+				}
+				params[i] = p
+			}
+			ctx.Params = params
+		}
+		for _, h := range v.handlers {
+			ctx.handlersStack.Use(h)
+		}
+		ctx.Next()
+	}}
+}
+
+// parseConstraints strips the <constraint> of the path params, and returns the tree path and the constraints.
+func parseConstraints(path string) (string, []paramConstraint) {
+	var (
+		b           strings.Builder
+		constraints []paramConstraint
+	)
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		b.WriteByte(c)
+		if c != ':' && c != '*' {
+			continue
+		}
+		start := i + 1
+		for i+1 < len(path) && path[i+1] != '/' && path[i+1] != '<' {
+			i++
+			b.WriteByte(path[i])
+		}
+		if i+1 == len(path) || path[i+1] != '<' {
+			continue
+		}
+		name := path[start : i+1]
+		// Find the closing '>', the constraint may contain nested '<' '>' and '/'.
+		depth, end := 0, -1
+		for j := i + 1; j < len(path) && end < 0; j++ {
+			switch path[j] {
+			case '\\':
+				j++
+			case '<':
+				depth++
+			case '>':
+				if depth--; depth == 0 {
+					end = j
+				}
+			}
+		}
+		assert1(end > 0, "unclosed constraint of param '"+name+"' in path '"+path+"'")
+		spec := path[i+2 : end]
+		constraints = append(constraints, paramConstraint{param: name, spec: spec, check: constraintCheck(spec, path)})
+		i = end
+	}
+	return b.String(), constraints
+}
+
+func constraintCheck(spec string, path string) func(string) bool {
+	if strings.HasPrefix(spec, "regex:") {
+		re, err := regexp.Compile("^(?:" + spec[6:] + ")$")
+		assert1(err == nil, "invalid regex constraint '"+spec+"' in path '"+path+"'")
+		return re.MatchString
+	}
+	check, ok := paramConstraints[spec]
+	assert1(ok, "unknown constraint '"+spec+"' in path '"+path+"'")
+	return check
+}
+
+// sameConstraints tells if two constraint lists are equivalent.
+func sameConstraints(a, b []paramConstraint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].param != b[i].param || a[i].spec != b[i].spec {
+			return false
+		}
+	}
+	return true
+}
+
+// ParamInt returns the URL param as an int, or a ValidationError.
+func (ctx *Context) ParamInt(key string) (int, error) {
+	v, err := strconv.Atoi(ctx.Param(key))
+	if err != nil {
+		return 0, (&ValidationError{}).New(key + " must be a number")
+	}
+	return v, nil
+}
+
+// ParamInt64 returns the URL param as an int64, or a ValidationError.
+func (ctx *Context) ParamInt64(key string) (int64, error) {
+	v, err := strconv.ParseInt(ctx.Param(key), 10, 64)
+	if err != nil {
+		return 0, (&ValidationError{}).New(key + " must be a number")
+	}
+	return v, nil
+}
+
+// ParamUUID returns the URL param if it is a UUID, or a ValidationError.
+func (ctx *Context) ParamUUID(key string) (string, error) {
+	v := ctx.Param(key)
+	if uuidPattern.MatchString(v) == false {
+		return "", (&ValidationError{}).New(key + " must be a UUID")
+	}
+	return strings.ToLower(v), nil
+}
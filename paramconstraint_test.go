@@ -0,0 +1,94 @@
+package core
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestParamConstraints(t *testing.T) {
+	engine := create()
+	engine.GET("/users/:id", func(c *Context) { c.Ok("name") })
+	engine.GET("/users/:id<int>", func(c *Context) {
+		id, err := c.ParamInt("id")
+		if err != nil {
+			c.Fail(err)
+			return
+		}
+		c.Ok(id)
+	})
+	engine.GET("/users/:id<uuid>/files/*file", func(c *Context) { c.Ok("uuid") })
+	engine.GET("/files/:name<regex:[a-z]+\\.png>", func(c *Context) { c.Ok("png") })
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/users/42", http.StatusOK, `{"ok":true,"data":42,"message":"","errno":0}`},
+		{"/users/foo", http.StatusOK, `{"ok":true,"data":"name","message":"","errno":0}`},
+		{"/users/0b9c6e4a-6d2b-4d7e-9f3a-1c2d3e4f5a6b/files/a/b", http.StatusOK, `{"ok":true,"data":"uuid","message":"","errno":0}`},
+		{"/users/42/files/a", http.StatusNotFound, ""},
+		{"/files/logo.png", http.StatusOK, `{"ok":true,"data":"png","message":"","errno":0}`},
+		{"/files/logo.jpg", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		r, _ := http.NewRequest("GET", tt.path, nil)
+		w := performRequest(engine, r)
+		if w.Code != tt.code || (tt.body != "" && w.Body.String() != tt.body) {
+			t.Errorf("%s: want %d %s, got %d %s", tt.path, tt.code, tt.body, w.Code, w.Body.String())
+		}
+	}
+
+	if routes := engine.Routes(); routes[1].Path != "/users/:id" || routes[1].Constraints["id"] != "int" {
+		t.Errorf("route: got %+v", routes[1])
+	}
+}
+
+func TestParamConstraintConflict(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("registering the same constraints twice should panic")
+		}
+	}()
+	engine := create()
+	engine.GET("/users/:id<int>", showUser)
+	engine.GET("/users/:id<int>", showUser)
+}
+
+func TestParamUUID(t *testing.T) {
+	c := &Context{Params: Params{{"id", "not-a-uuid"}}}
+	if _, err := c.ParamUUID("id"); err == nil {
+		t.Error("want a ValidationError")
+	} else if _, ok := err.(*ValidationError); ok == false {
+		t.Errorf("want a ValidationError, got %T", err)
+	}
+}
+
+func TestParamConstraintNames(t *testing.T) {
+	engine := create()
+	engine.GET("/users/:id<int>", func(c *Context) { c.Ok("id " + c.Param("id")) })
+	engine.GET("/users/:name<alpha>", func(c *Context) { c.Ok("name " + c.Param("name")) })
+	engine.GET("/users/:slug/posts", func(c *Context) { c.Ok("slug " + c.Param("slug")) })
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/users/42", http.StatusOK, `{"ok":true,"data":"id 42","message":"","errno":0}`},
+		{"/users/bob", http.StatusOK, `{"ok":true,"data":"name bob","message":"","errno":0}`},
+		{"/users/bob-1", http.StatusNotFound, ""},
+		{"/users/bob-1/posts", http.StatusOK, `{"ok":true,"data":"slug bob-1","message":"","errno":0}`},
+	}
+	for _, tt := range tests {
+		r, _ := http.NewRequest("GET", tt.path, nil)
+		w := performRequest(engine, r)
+		if w.Code != tt.code || (tt.body != "" && w.Body.String() != tt.body) {
+			t.Errorf("%s: want %d %s, got %d %s", tt.path, tt.code, tt.body, w.Code, w.Body.String())
+		}
+	}
+
+	if routes := engine.Routes(); routes[1].Path != "/users/:name" || routes[1].Constraints["name"] != "alpha" {
+		t.Errorf("route: got %+v", routes[1])
+	}
+}
@@ -0,0 +1,68 @@
+package core
+
+import (
+	"net/http"
+	"time"
+
+	corelog "github.com/HiLittleCat/core/log"
+)
+
+// ErrorReporter receives the panics recovered while serving, e.g. to send them to an error tracker, see ReportErrors.
+type ErrorReporter interface {
+	Report(report *ErrorReport)
+}
+
+// ErrorReporterFunc is a func used as an ErrorReporter.
+type ErrorReporterFunc func(report *ErrorReport)
+
+// Report calls f.
+func (f ErrorReporterFunc) Report(report *ErrorReport) {
+	f(report)
+}
+
+// ErrorReport is a recovered panic and the snapshot of its request.
+type ErrorReport struct {
+	Err        interface{} // recovered value
+	Stack      string      // stack without the frames of the runtime, net/http and core
+	Caller     string      // package of the function that panicked
+	Time       time.Time
+	Method     string
+	URL        string
+	Header     http.Header // request headers, without the credentials
+	RemoteAddr string
+	Principal  string // id of the authenticated principal
+}
+
+// stackPackages are the packages trimmed from the reported stacks.
+var stackPackages = []string{"runtime", "net/http", "github.com/HiLittleCat/core"}
+
+// trimStack removes the framework frames from the stack.
+func trimStack(stack []byte) []byte {
+	return corelog.TrimStack(stack, stackPackages...)
+}
+
+func newErrorReport(ctx *Context, err interface{}, stack []byte) *ErrorReport {
+	r := ctx.Request
+	report := &ErrorReport{
+		Err:        err,
+		Stack:      string(trimStack(stack)),
+		Caller:     corelog.PanicPackage(stack),
+		Time:       time.Now(),
+		Method:     r.Method,
+		URL:        r.URL.String(),
+		Header:     http.Header{},
+		RemoteAddr: r.RemoteAddr,
+	}
+	for k, v := range r.Header {
+		switch k {
+		case "Authorization", "Cookie", "Proxy-Authorization":
+			report.Header[k] = []string{"[FILTERED]"}
+		default:
+			report.Header[k] = append([]string{}, v...)
+		}
+	}
+	if p := ctx.Principal(); p != nil {
+		report.Principal = p.ID
+	}
+	return report
+}
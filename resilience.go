@@ -0,0 +1,428 @@
+package core
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// BulkheadConfig configures a Bulkhead.
+type BulkheadConfig struct {
+	MaxConcurrent int           // requests served at once, default is 100
+	MaxQueue      int           // requests waiting for a slot, the others are rejected at once
+	QueueTimeout  time.Duration // max wait for a slot, default is 1s
+	// Target enables the load shedding: when the queue has not been emptied for Interval, or the requests have been
+	// served slower than Target for Interval, the wait is shortened to Target, like CoDel does, so that the queue
+	// drains instead of adding latency to every request.
+	Target     time.Duration
+	Interval   time.Duration                     // default is 100ms
+	RetryAfter time.Duration                     // Retry-After of the rejected requests, default is 1s
+	OnReject   func(ctx *Context, reason string) // called before a request is rejected: "queue full", "timeout", "shed" or "canceled"
+}
+
+// BulkheadMetrics is the state of a Bulkhead.
+type BulkheadMetrics struct {
+	Name       string
+	InFlight   int64 // requests being served
+	Queued     int64 // requests waiting for a slot
+	Accepted   int64
+	Rejected   int64 // rejected because the queue was full or the wait timed out
+	Shed       int64 // rejected by the load shedding
+	Overloaded bool  // the load shedding is active
+}
+
+// Bulkhead limits the concurrent requests of the routes using its Handler, the other requests wait in a queue.
+//
+//	db := core.NewBulkhead("db", core.BulkheadConfig{MaxConcurrent: 20, MaxQueue: 100, Target: 5 * time.Millisecond})
+//	router.GET("/reports", db.Handler(), getReports)
+//
+// The rejected requests are responded an UnavailableError, 503 with a Retry-After header.
+type Bulkhead struct {
+	lastEmpty int64 // unix nano time the queue was last seen empty
+	slowSince int64 // unix nano time the requests have been served slower than Target since, 0 if the last one was not
+	inFlight  int64
+	queued    int64
+	accepted  int64
+	rejected  int64
+	shed      int64
+	name      string
+	cfg       BulkheadConfig
+	slots     chan struct{}
+}
+
+var (
+	resilienceMu sync.Mutex
+	bulkheads    = make(map[string]*Bulkhead)
+	breakers     = make(map[string]*Breaker)
+)
+
+// NewBulkhead returns the bulkhead named name, its metrics are listed by AllBulkheadMetrics.
+// It panics if a bulkhead of this name exists, Close frees the name.
+func NewBulkhead(name string, cfg BulkheadConfig) *Bulkhead {
+	if cfg.MaxConcurrent <= 0 {
+		cfg.MaxConcurrent = 100
+	}
+	if cfg.QueueTimeout <= 0 {
+		cfg.QueueTimeout = time.Second
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 100 * time.Millisecond
+	}
+	if cfg.RetryAfter <= 0 {
+		cfg.RetryAfter = time.Second
+	}
+	b := &Bulkhead{name: name, cfg: cfg, slots: make(chan struct{}, cfg.MaxConcurrent), lastEmpty: time.Now().UnixNano()}
+	resilienceMu.Lock()
+	defer resilienceMu.Unlock()
+	_, dup := bulkheads[name]
+	assert1(dup == false, "bulkhead "+name+" already exists")
+	bulkheads[name] = b
+	return b
+}
+
+// Close unregisters the bulkhead, so that its name can be used again. Its Handler keeps working.
+func (b *Bulkhead) Close() {
+	resilienceMu.Lock()
+	defer resilienceMu.Unlock()
+	if bulkheads[b.name] == b {
+		delete(bulkheads, b.name)
+	}
+}
+
+// Handler returns the middleware serving the requests within the limits of the bulkhead.
+func (b *Bulkhead) Handler() RouterHandler {
+	return func(ctx *Context) {
+		if reason := b.acquire(ctx); reason != "" {
+			if b.cfg.OnReject != nil {
+				b.cfg.OnReject(ctx, reason)
+			}
+			ctx.Fail((&UnavailableError{}).New(b.cfg.RetryAfter, "service is busy, retry later"))
+			return
+		}
+		defer b.release(time.Now())
+		ctx.Next()
+	}
+}
+
+// acquire waits for a slot, it returns the reason of the rejection if it did not get one.
+func (b *Bulkhead) acquire(ctx *Context) string {
+	select {
+	case b.slots <- struct{}{}:
+		b.admit()
+		atomic.StoreInt64(&b.lastEmpty, time.Now().UnixNano())
+		atomic.StoreInt64(&b.slowSince, 0)
+		return ""
+	default:
+	}
+	if atomic.AddInt64(&b.queued, 1) > int64(b.cfg.MaxQueue) {
+		atomic.AddInt64(&b.queued, -1)
+		atomic.AddInt64(&b.rejected, 1)
+		return "queue full"
+	}
+	defer atomic.AddInt64(&b.queued, -1)
+
+	overloaded := b.overloaded()
+	timeout := b.cfg.QueueTimeout
+	if overloaded && b.cfg.Target < timeout {
+		timeout = b.cfg.Target
+	}
+	start := time.Now()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case b.slots <- struct{}{}:
+		b.admit()
+		if time.Since(start) <= b.cfg.Target || atomic.LoadInt64(&b.queued) == 1 {
+			atomic.StoreInt64(&b.lastEmpty, time.Now().UnixNano())
+		}
+		return ""
+	case <-timer.C:
+		if overloaded {
+			atomic.AddInt64(&b.shed, 1)
+			return "shed"
+		}
+		atomic.AddInt64(&b.rejected, 1)
+		return "timeout"
+	case <-ctx.Request.Context().Done():
+		atomic.AddInt64(&b.rejected, 1)
+		return "canceled"
+	}
+}
+
+func (b *Bulkhead) admit() {
+	atomic.AddInt64(&b.inFlight, 1)
+	atomic.AddInt64(&b.accepted, 1)
+}
+
+// release frees the slot of a request admitted at start, and records if it was served slower than Target.
+func (b *Bulkhead) release(start time.Time) {
+	atomic.AddInt64(&b.inFlight, -1)
+	<-b.slots
+	if b.cfg.Target <= 0 {
+		return
+	}
+	if now := time.Now(); now.Sub(start) > b.cfg.Target {
+		atomic.CompareAndSwapInt64(&b.slowSince, 0, now.UnixNano())
+	} else {
+		atomic.StoreInt64(&b.slowSince, 0)
+	}
+}
+
+// overloaded tells if the queue has not been emptied for Interval, or if the requests have been served slower
+// than Target for Interval, when the load shedding is enabled.
+func (b *Bulkhead) overloaded() bool {
+	if b.cfg.Target <= 0 {
+		return false
+	}
+	if time.Since(time.Unix(0, atomic.LoadInt64(&b.lastEmpty))) > b.cfg.Interval {
+		return true
+	}
+	slow := atomic.LoadInt64(&b.slowSince)
+	return slow != 0 && time.Since(time.Unix(0, slow)) > b.cfg.Interval
+}
+
+// Metrics returns the state of the bulkhead.
+func (b *Bulkhead) Metrics() BulkheadMetrics {
+	return BulkheadMetrics{
+		Name:       b.name,
+		InFlight:   atomic.LoadInt64(&b.inFlight),
+		Queued:     atomic.LoadInt64(&b.queued),
+		Accepted:   atomic.LoadInt64(&b.accepted),
+		Rejected:   atomic.LoadInt64(&b.rejected),
+		Shed:       atomic.LoadInt64(&b.shed),
+		Overloaded: atomic.LoadInt64(&b.queued) > 0 && b.overloaded(),
+	}
+}
+
+// AllBulkheadMetrics returns the metrics of the bulkheads, by name.
+func AllBulkheadMetrics() []BulkheadMetrics {
+	resilienceMu.Lock()
+	defer resilienceMu.Unlock()
+	metrics := make([]BulkheadMetrics, 0, len(bulkheads))
+	for _, b := range bulkheads {
+		metrics = append(metrics, b.Metrics())
+	}
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].Name < metrics[j].Name })
+	return metrics
+}
+
+// BreakerState is the state of a Breaker.
+type BreakerState int
+
+// Breaker states.
+const (
+	BreakerClosed   BreakerState = iota // the calls are made
+	BreakerOpen                         // the calls fail at once
+	BreakerHalfOpen                     // trial calls are made to tell if the service is back
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	default:
+		return "half-open"
+	}
+}
+
+// BreakerConfig configures a Breaker.
+type BreakerConfig struct {
+	MaxFailures      int                                      // consecutive failures opening the breaker, default is 5
+	OpenTimeout      time.Duration                            // time the breaker stays open before trial calls, default is 30s
+	HalfOpenRequests int                                      // trial calls made while half-open, the breaker closes when they all succeed, default is 1
+	IsFailure        func(err error) bool                     // default counts the errors other than the client errors (4xx ICoreError)
+	OnStateChange    func(name string, from, to BreakerState) // called when the state changes
+}
+
+// BreakerMetrics is the state of a Breaker.
+type BreakerMetrics struct {
+	Name      string
+	State     BreakerState
+	Failures  int // consecutive failures
+	Successes int64
+	Errors    int64 // failed calls
+	Rejected  int64 // calls not made because the breaker was open
+}
+
+// Breaker is a circuit breaker stopping the calls to a failing downstream service for a while:
+//
+//	var payments = core.NewBreaker("payments", core.BreakerConfig{})
+//
+//	err := payments.Do(func() error {
+//		return client.Charge(order)
+//	})
+//
+// Do returns an UnavailableError while the breaker is open, so the handlers respond 503 with a Retry-After header.
+type Breaker struct {
+	name      string
+	cfg       BreakerConfig
+	mu        sync.Mutex
+	state     BreakerState
+	failures  int
+	trials    int // calls admitted while half-open
+	recovered int // trial calls succeeded while half-open
+	openedAt  time.Time
+	successes int64
+	errors    int64
+	rejected  int64
+	changes   [][2]BreakerState // state changes to notify
+}
+
+// NewBreaker returns the breaker named name, its metrics are listed by AllBreakerMetrics.
+// It panics if a breaker of this name exists, Close frees the name.
+func NewBreaker(name string, cfg BreakerConfig) *Breaker {
+	if cfg.MaxFailures <= 0 {
+		cfg.MaxFailures = 5
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = 30 * time.Second
+	}
+	if cfg.HalfOpenRequests <= 0 {
+		cfg.HalfOpenRequests = 1
+	}
+	if cfg.IsFailure == nil {
+		cfg.IsFailure = func(err error) bool {
+			if e, ok := err.(ICoreError); ok {
+				return e.GetHTTPCode() < 400 || e.GetHTTPCode() >= 500
+			}
+			return err != nil
+		}
+	}
+	b := &Breaker{name: name, cfg: cfg}
+	resilienceMu.Lock()
+	defer resilienceMu.Unlock()
+	_, dup := breakers[name]
+	assert1(dup == false, "breaker "+name+" already exists")
+	breakers[name] = b
+	return b
+}
+
+// Close unregisters the breaker, so that its name can be used again. Do keeps working.
+func (b *Breaker) Close() {
+	resilienceMu.Lock()
+	defer resilienceMu.Unlock()
+	if breakers[b.name] == b {
+		delete(breakers, b.name)
+	}
+}
+
+// Do calls fn if the breaker allows it, and records its result.
+// A panic of fn is recorded as a failure before being propagated.
+func (b *Breaker) Do(fn func() error) (err error) {
+	if err = b.allow(); err != nil {
+		return err
+	}
+	done := false
+	defer func() {
+		if done == false {
+			b.record(false)
+		}
+	}()
+	err = fn()
+	done = true
+	b.record(err == nil || b.cfg.IsFailure(err) == false)
+	return err
+}
+
+// allow returns an UnavailableError if the call can not be made.
+func (b *Breaker) allow() error {
+	defer b.notify()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen {
+		wait := b.cfg.OpenTimeout - time.Since(b.openedAt)
+		if wait > 0 {
+			b.rejected++
+			return (&UnavailableError{}).New(wait, b.name+" is unavailable")
+		}
+		b.setState(BreakerHalfOpen)
+	}
+	if b.state == BreakerHalfOpen {
+		if b.trials >= b.cfg.HalfOpenRequests {
+			b.rejected++
+			return (&UnavailableError{}).New(time.Second, b.name+" is unavailable")
+		}
+		b.trials++
+	}
+	return nil
+}
+
+// record updates the state with the result of a call.
+func (b *Breaker) record(success bool) {
+	defer b.notify()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if success {
+		b.successes++
+		b.failures = 0
+		if b.state == BreakerHalfOpen {
+			if b.recovered++; b.recovered >= b.cfg.HalfOpenRequests {
+				b.setState(BreakerClosed)
+			}
+		}
+		return
+	}
+	b.errors++
+	b.failures++
+	if b.state == BreakerHalfOpen || b.state == BreakerClosed && b.failures >= b.cfg.MaxFailures {
+		b.openedAt = time.Now()
+		b.setState(BreakerOpen)
+	}
+}
+
+// setState changes the state, b.mu is locked.
+func (b *Breaker) setState(to BreakerState) {
+	from := b.state
+	if from == to {
+		return
+	}
+	b.state = to
+	b.trials = 0
+	b.recovered = 0
+	b.changes = append(b.changes, [2]BreakerState{from, to})
+}
+
+// notify logs the state changes and calls OnStateChange, once b.mu is unlocked.
+func (b *Breaker) notify() {
+	b.mu.Lock()
+	changes := b.changes
+	b.changes = nil
+	b.mu.Unlock()
+	for _, c := range changes {
+		log.WithFields(log.Fields{"breaker": b.name, "from": c[0].String(), "to": c[1].String()}).Warnln("breaker state changed")
+		if b.cfg.OnStateChange != nil {
+			b.cfg.OnStateChange(b.name, c[0], c[1])
+		}
+	}
+}
+
+// State returns the state of the breaker.
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Metrics returns the state of the breaker.
+func (b *Breaker) Metrics() BreakerMetrics {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return BreakerMetrics{Name: b.name, State: b.state, Failures: b.failures, Successes: b.successes, Errors: b.errors, Rejected: b.rejected}
+}
+
+// AllBreakerMetrics returns the metrics of the breakers, by name.
+func AllBreakerMetrics() []BreakerMetrics {
+	resilienceMu.Lock()
+	defer resilienceMu.Unlock()
+	metrics := make([]BreakerMetrics, 0, len(breakers))
+	for _, b := range breakers {
+		metrics = append(metrics, b.Metrics())
+	}
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].Name < metrics[j].Name })
+	return metrics
+}
@@ -0,0 +1,241 @@
+package core
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBulkhead(t *testing.T) {
+	var reasons []string
+	defer forget("test")
+	b := NewBulkhead("test", BulkheadConfig{
+		MaxConcurrent: 1,
+		MaxQueue:      1,
+		QueueTimeout:  time.Second,
+		OnReject:      func(c *Context, reason string) { reasons = append(reasons, reason) },
+	})
+	release := make(chan struct{})
+	var served int32
+	engine := create()
+	engine.GET("/work", b.Handler(), func(c *Context) {
+		atomic.AddInt32(&served, 1)
+		<-release
+		c.Ok(nil)
+	})
+	serve := func() chan *httptest.ResponseRecorder {
+		done := make(chan *httptest.ResponseRecorder, 1)
+		go func() {
+			r, _ := http.NewRequest("GET", "/work", nil)
+			done <- performRequest(engine, r)
+		}()
+		return done
+	}
+
+	first := serve()
+	for atomic.LoadInt32(&served) != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	second := serve()
+	for b.Metrics().Queued != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	w := <-serve()
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("queue full: want 503 with Retry-After, got %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	release <- struct{}{}
+	release <- struct{}{}
+	if w := <-first; w.Code != http.StatusOK {
+		t.Errorf("first: want 200, got %d", w.Code)
+	}
+	if w := <-second; w.Code != http.StatusOK {
+		t.Errorf("queued: want 200, got %d", w.Code)
+	}
+	m := b.Metrics()
+	if m.Accepted != 2 || m.Rejected != 1 || m.InFlight != 0 || m.Queued != 0 {
+		t.Errorf("want 2 accepted and 1 rejected, got %+v", m)
+	}
+	if len(reasons) != 1 || reasons[0] != "queue full" {
+		t.Errorf("want queue full hook, got %v", reasons)
+	}
+}
+
+func TestBulkheadShedding(t *testing.T) {
+	defer forget("shedding")
+	b := NewBulkhead("shedding", BulkheadConfig{MaxConcurrent: 1, MaxQueue: 10, QueueTimeout: time.Minute, Target: 5 * time.Millisecond})
+	release := make(chan struct{})
+	engine := create()
+	engine.GET("/work", b.Handler(), func(c *Context) {
+		<-release
+		c.Ok(nil)
+	})
+	go func() {
+		r, _ := http.NewRequest("GET", "/work", nil)
+		performRequest(engine, r)
+	}()
+	for b.Metrics().InFlight != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	// The queue has not been empty for longer than the interval.
+	atomic.StoreInt64(&b.lastEmpty, time.Now().Add(-time.Second).UnixNano())
+
+	start := time.Now()
+	r, _ := http.NewRequest("GET", "/work", nil)
+	w := performRequest(engine, r)
+	if w.Code != http.StatusServiceUnavailable || time.Since(start) > time.Second {
+		t.Errorf("want 503 after the target delay, got %d after %v", w.Code, time.Since(start))
+	}
+	if m := b.Metrics(); m.Shed != 1 {
+		t.Errorf("want 1 shed, got %+v", m)
+	}
+	close(release)
+}
+
+func TestBulkheadLatencyShedding(t *testing.T) {
+	defer forget("latency")
+	b := NewBulkhead("latency", BulkheadConfig{MaxConcurrent: 1, MaxQueue: 10, QueueTimeout: time.Minute, Target: 5 * time.Millisecond, Interval: 10 * time.Millisecond})
+	release := make(chan struct{})
+	engine := create()
+	engine.GET("/work", b.Handler(), func(c *Context) {
+		<-release
+		c.Ok(nil)
+	})
+	serve := func() {
+		r, _ := http.NewRequest("GET", "/work", nil)
+		performRequest(engine, r)
+	}
+	go serve()
+	for b.Metrics().InFlight != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	go serve()
+	for b.Metrics().Queued != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	// The first request is served slower than the target, the second one takes its slot.
+	time.Sleep(10 * time.Millisecond)
+	release <- struct{}{}
+	for b.Metrics().Queued != 0 || b.Metrics().InFlight != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if atomic.LoadInt64(&b.slowSince) == 0 {
+		t.Fatal("want the slow request recorded")
+	}
+	time.Sleep(20 * time.Millisecond)
+	// The queue has been emptied lately, the shedding is driven by the latency only.
+	atomic.StoreInt64(&b.lastEmpty, time.Now().UnixNano())
+
+	r, _ := http.NewRequest("GET", "/work", nil)
+	if w := performRequest(engine, r); w.Code != http.StatusServiceUnavailable || b.Metrics().Shed != 1 {
+		t.Errorf("want shed while the requests are slow, got %d %+v", w.Code, b.Metrics())
+	}
+	close(release)
+}
+
+func TestResilienceDuplicateName(t *testing.T) {
+	defer forget("duplicate")
+	NewBulkhead("duplicate", BulkheadConfig{})
+	NewBreaker("duplicate", BreakerConfig{})
+	for name, fn := range map[string]func(){
+		"bulkhead": func() { NewBulkhead("duplicate", BulkheadConfig{}) },
+		"breaker":  func() { NewBreaker("duplicate", BreakerConfig{}) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: want a panic for a duplicate name", name)
+				}
+			}()
+			fn()
+		}()
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	var changes []string
+	defer forget("downstream")
+	b := NewBreaker("downstream", BreakerConfig{
+		MaxFailures: 2,
+		OpenTimeout: 20 * time.Millisecond,
+		OnStateChange: func(name string, from, to BreakerState) {
+			changes = append(changes, from.String()+">"+to.String())
+		},
+	})
+	down := errors.New("down")
+	fail := func() error { return down }
+	ok := func() error { return nil }
+
+	if err := b.Do(func() error { return (&ValidationError{}).New("bad") }); b.Metrics().Failures != 0 {
+		t.Errorf("client error: want no failure, got %v %+v", err, b.Metrics())
+	}
+	b.Do(fail)
+	if err := b.Do(fail); err != down || b.State() != BreakerOpen {
+		t.Fatalf("want open after 2 failures, got %v %v", err, b.State())
+	}
+	err := b.Do(ok)
+	if e, isUnavailable := err.(*UnavailableError); isUnavailable == false || e.RetryAfter <= 0 {
+		t.Errorf("open: want UnavailableError, got %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if err := b.Do(ok); err != nil || b.State() != BreakerClosed {
+		t.Errorf("half-open: want closed after a successful trial, got %v %v", err, b.State())
+	}
+	want := "closed>open,open>half-open,half-open>closed"
+	if got := strings.Join(changes, ","); got != want {
+		t.Errorf("state changes: want %s, got %s", want, got)
+	}
+	if m := b.Metrics(); m.Rejected != 1 || m.Errors != 2 {
+		t.Errorf("want 1 rejected and 2 errors, got %+v", m)
+	}
+}
+
+func TestBreakerHalfOpenRequests(t *testing.T) {
+	b := NewBreaker("trials", BreakerConfig{MaxFailures: 1, OpenTimeout: 10 * time.Millisecond, HalfOpenRequests: 2})
+	defer b.Close()
+	b.Do(func() error { return errors.New("down") })
+	time.Sleep(20 * time.Millisecond)
+
+	release := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- b.Do(func() error {
+			<-release
+			return nil
+		})
+	}()
+	for b.Metrics().State != BreakerHalfOpen {
+		time.Sleep(time.Millisecond)
+	}
+	if err := b.Do(func() error { return nil }); err != nil || b.State() != BreakerHalfOpen {
+		t.Errorf("want half-open while a trial runs, got %v %v", err, b.State())
+	}
+	close(release)
+	if err := <-done; err != nil || b.State() != BreakerClosed {
+		t.Errorf("want closed after the trials succeeded, got %v %v", err, b.State())
+	}
+}
+
+func TestResilienceClose(t *testing.T) {
+	bh, b := NewBulkhead("closed", BulkheadConfig{}), NewBreaker("closed", BreakerConfig{})
+	bh.Close()
+	b.Close()
+	bh, b = NewBulkhead("closed", BulkheadConfig{}), NewBreaker("closed", BreakerConfig{})
+	defer bh.Close()
+	defer b.Close()
+	if len(AllBulkheadMetrics()) != 1 || len(AllBreakerMetrics()) != 1 {
+		t.Errorf("want the new bulkhead and breaker registered, got %+v %+v", AllBulkheadMetrics(), AllBreakerMetrics())
+	}
+}
+
+// forget unregisters the bulkhead and the breaker named name, so that the tests can be run again.
+func forget(name string) {
+	resilienceMu.Lock()
+	delete(bulkheads, name)
+	delete(breakers, name)
+	resilienceMu.Unlock()
+}
@@ -1,5 +1,9 @@
 package core
 
+import (
+	"strings"
+)
+
 // Routers create router instance
 var Routers = create()
 
@@ -11,9 +15,28 @@ type Engine struct {
 	noRoute     RouterHandlerChain
 	noMethod    RouterHandlerChain
 	trees       methodTrees
+	variants    map[string]*routeVariants // routes by method and tree path, see parseConstraints
+	paramNames  map[string]string         // names of the params in the tree by method and path prefix, see canonicalParams
+	host        string                    // host pattern of the engine, empty for the default engine
+	hosts       []*Engine                 // host engines, see Host
+	*routeTable                           // shared by the default engine and its host engines
+}
+
+// routeTable keeps the routes for introspection.
+type routeTable struct {
+	routes      []*RouteInfo          // all the routes in registration order
+	namedRoutes map[string]*RouteInfo // routes by name
+
+	errorHandlers []ErrorHandler // see OnError
 }
 
-func (engine *Engine) addRoute(method, path string, handlers RouterHandlerChain) {
+func (engine *Engine) addRoute(method, path string, handlers RouterHandlerChain) *RouteInfo {
+	treePath, constraints := engine.insertRoute(method, path, handlers)
+	return engine.addRouteInfo(method, treePath, constraints, handlers)
+}
+
+// insertRoute adds the handlers to the tree of the method, and returns the tree path and the param constraints.
+func (engine *Engine) insertRoute(method, path string, handlers RouterHandlerChain) (string, []paramConstraint) {
 	assert1(path[0] == '/', "path must begin with '/'")
 	assert1(method != "", "HTTP method can not be empty")
 	assert1(len(handlers) > 0, "there must be at least one handler")
@@ -23,7 +46,81 @@ func (engine *Engine) addRoute(method, path string, handlers RouterHandlerChain)
 		root = new(node)
 		engine.trees = append(engine.trees, methodTree{method: method, root: root})
 	}
-	root.addRoute(path, handlers)
+
+	treePath, constraints := parseConstraints(path)
+	canonical, renames := engine.canonicalParams(method, treePath)
+	key := method + " " + canonical
+	variants, exists := engine.variants[key]
+	if exists == false {
+		variants = &routeVariants{}
+		engine.variants[key] = variants
+	}
+	v := &routeVariant{constraints: constraints, handlers: handlers, renames: renames}
+	if renames != nil {
+		// The constraints check the params by their names in the tree.
+		v.constraints = make([]paramConstraint, len(constraints))
+		copy(v.constraints, constraints)
+		for i := range v.constraints {
+			for name, own := range renames {
+				if v.constraints[i].param == own {
+					v.constraints[i].param = name
+				}
+			}
+		}
+	}
+	for _, other := range *variants {
+		if sameConstraints(other.constraints, v.constraints) {
+			panic("handlers are already registered for path '" + path + "'")
+		}
+	}
+	if len(constraints) > 0 {
+		// Constrained variants are tried before the unconstrained one.
+		i := len(*variants)
+		if i > 0 && len((*variants)[i-1].constraints) == 0 {
+			i--
+		}
+		*variants = append(*variants, nil)
+		copy((*variants)[i+1:], (*variants)[i:])
+		(*variants)[i] = v
+	} else {
+		*variants = append(*variants, v)
+	}
+
+	switch {
+	case exists == false && len(constraints) == 0 && renames == nil:
+		root.addRoute(canonical, handlers)
+	case exists == false:
+		root.addRoute(canonical, variants.dispatch())
+	case len(*variants) == 2:
+		// The path had a single variant so far, dispatch between the variants from now on.
+		root.leaf(canonical).handlers = variants.dispatch()
+	}
+	return treePath, constraints
+}
+
+// canonicalParams returns the tree path using the param names of the routes registered before at the same positions,
+// and the names of the path by the tree names, nil if they are the same.
+// So /users/:id<int> and /users/:name<alpha> share the tree node /users/:id, and the handlers get the param name.
+func (engine *Engine) canonicalParams(method, treePath string) (string, map[string]string) {
+	var renames map[string]string
+	segments := strings.Split(treePath, "/")
+	prefix := method + " "
+	for i, s := range segments {
+		if j := strings.IndexAny(s, ":*"); j >= 0 {
+			key := prefix + s[:j+1]
+			if name, ok := engine.paramNames[key]; ok == false {
+				engine.paramNames[key] = s[j+1:]
+			} else if name != s[j+1:] {
+				if renames == nil {
+					renames = map[string]string{}
+				}
+				renames[name] = s[j+1:]
+				segments[i] = s[:j+1] + name
+			}
+		}
+		prefix += segments[i] + "/"
+	}
+	return strings.Join(segments, "/"), renames
 }
 
 // create returns a new blank Engine instance without any middleware attached.
@@ -34,36 +131,47 @@ func create() *Engine {
 			basePath: "/",
 			root:     true,
 		},
-		trees: make(methodTrees, 0, 9),
+		trees:      make(methodTrees, 0, 9),
+		variants:   make(map[string]*routeVariants),
+		paramNames: make(map[string]string),
+		routeTable: &routeTable{},
 	}
 	engine.RouterGroup.engine = engine
 	return engine
 }
 
 func (engine *Engine) handlers(ctx *Context) {
-	httpMethod := ctx.Request.Method
-	path := ctx.Request.URL.Path
+	ctx.engine = engine
+	target := engine
+	var hostParams Params
+	if len(engine.hosts) > 0 {
+		if h, params := engine.matchHost(ctx.Request.Host); h != nil {
+			target, hostParams = h, params
+		}
+	}
+	handlers, params := target.getValue(ctx.Request.Method, ctx.Request.URL.Path, ctx.Params)
+	if handlers == nil {
+		ctx.Fail((&NotFoundError{}).New("Url Not found"))
+		return
+	}
+	ctx.Params = append(params, hostParams...)
+	engine.exeHandlers(ctx, handlers)
+}
+
+// getValue finds the route in the tree of the method.
+func (engine *Engine) getValue(httpMethod, path string, po Params) (RouterHandlerChain, Params) {
 	unescape := false
-	found := false
 	// Find root of the tree for the given HTTP method
 	t := engine.trees
 	for i, tl := 0, len(t); i < tl; i++ {
 		if t[i].method == httpMethod {
 			root := t[i].root
 			// Find route in tree
-			handlers, params, _ := root.getValue(path, ctx.Params, unescape)
-			if handlers != nil {
-				found = true
-				ctx.Params = params
-				engine.exeHandlers(ctx, handlers)
-				return
-			}
-			break
+			handlers, params, _ := root.getValue(path, po, unescape)
+			return handlers, params
 		}
 	}
-	if found == false {
-		ctx.Fail((&NotFoundError{}).New("Url Not found"))
-	}
+	return nil, po
 }
 
 func (engine *Engine) exeHandlers(ctx *Context, handlers RouterHandlerChain) {
@@ -16,15 +16,15 @@ type IRouter interface {
 
 // IRoutes routes interface
 type IRoutes interface {
-	Handle(string, string, ...RouterHandler) IRoutes
-	Any(string, ...RouterHandler) IRoutes
-	GET(string, ...RouterHandler) IRoutes
-	POST(string, ...RouterHandler) IRoutes
-	DELETE(string, ...RouterHandler) IRoutes
-	PATCH(string, ...RouterHandler) IRoutes
-	PUT(string, ...RouterHandler) IRoutes
-	OPTIONS(string, ...RouterHandler) IRoutes
-	HEAD(string, ...RouterHandler) IRoutes
+	Handle(string, string, ...RouterHandler) *Route
+	Any(string, ...RouterHandler) *Route
+	GET(string, ...RouterHandler) *Route
+	POST(string, ...RouterHandler) *Route
+	DELETE(string, ...RouterHandler) *Route
+	PATCH(string, ...RouterHandler) *Route
+	PUT(string, ...RouterHandler) *Route
+	OPTIONS(string, ...RouterHandler) *Route
+	HEAD(string, ...RouterHandler) *Route
 }
 
 // RouterHandler http handler
@@ -40,6 +40,7 @@ type RouterGroup struct {
 	basePath string
 	engine   *Engine
 	root     bool
+	version  *apiVersion // set on the groups of a Versioning
 }
 
 var _ IRouter = &RouterGroup{}
@@ -48,6 +49,8 @@ const abortIndex = 5
 
 // Use adds middleware to the group, see example code in github.
 func (group *RouterGroup) Use(middleware ...RouterHandler) IRoutes {
+	// The host groups copy the middlewares of the default engine when they are created.
+	assert1(group.root == false || len(group.engine.hosts) == 0, "Use must be called on the default engine before Host")
 	group.Handlers = append(group.Handlers, middleware...)
 	return group.returnObj()
 }
@@ -59,6 +62,7 @@ func (group *RouterGroup) Group(relativePath string, handlers ...RouterHandler)
 		Handlers: group.combineHandlers(handlers),
 		basePath: group.calculateAbsolutePath(relativePath),
 		engine:   group.engine,
+		version:  group.version,
 	}
 }
 
@@ -67,11 +71,21 @@ func (group *RouterGroup) BasePath() string {
 	return group.basePath
 }
 
-func (group *RouterGroup) handle(httpMethod, relativePath string, handlers RouterHandlerChain) IRoutes {
+func (group *RouterGroup) handle(httpMethod, relativePath string, handlers RouterHandlerChain) *Route {
 	absolutePath := group.calculateAbsolutePath(relativePath)
 	handlers = group.combineHandlers(handlers)
-	group.engine.addRoute(httpMethod, absolutePath, handlers)
-	return group.returnObj()
+	route := group.route()
+	if group.version != nil {
+		route.routes = group.version.addRoute(httpMethod, absolutePath, handlers)
+	} else {
+		route.routes = []*RouteInfo{group.engine.addRoute(httpMethod, absolutePath, handlers)}
+	}
+	return route
+}
+
+// route returns an empty handle of the routes of the group.
+func (group *RouterGroup) route() *Route {
+	return &Route{IRoutes: group.returnObj(), engine: group.engine}
 }
 
 // Handle registers a new request handle and middleware with the given path and method.
@@ -84,7 +98,7 @@ func (group *RouterGroup) handle(httpMethod, relativePath string, handlers Route
 // This function is intended for bulk loading and to allow the usage of less
 // frequently used, non-standardized or custom methods (e.g. for internal
 // communication with a proxy).
-func (group *RouterGroup) Handle(httpMethod, relativePath string, handlers ...RouterHandler) IRoutes {
+func (group *RouterGroup) Handle(httpMethod, relativePath string, handlers ...RouterHandler) *Route {
 	if matches, err := regexp.MatchString("^[A-Z]+$", httpMethod); !matches || err != nil {
 		panic("http method " + httpMethod + " is not valid")
 	}
@@ -92,53 +106,48 @@ func (group *RouterGroup) Handle(httpMethod, relativePath string, handlers ...Ro
 }
 
 // POST is a shortcut for router.Handle("POST", path, handle).
-func (group *RouterGroup) POST(relativePath string, handlers ...RouterHandler) IRoutes {
+func (group *RouterGroup) POST(relativePath string, handlers ...RouterHandler) *Route {
 	return group.handle("POST", relativePath, handlers)
 }
 
 // GET is a shortcut for router.Handle("GET", path, handle).
-func (group *RouterGroup) GET(relativePath string, handlers ...RouterHandler) IRoutes {
+func (group *RouterGroup) GET(relativePath string, handlers ...RouterHandler) *Route {
 	return group.handle("GET", relativePath, handlers)
 }
 
 // DELETE is a shortcut for router.Handle("DELETE", path, handle).
-func (group *RouterGroup) DELETE(relativePath string, handlers ...RouterHandler) IRoutes {
+func (group *RouterGroup) DELETE(relativePath string, handlers ...RouterHandler) *Route {
 	return group.handle("DELETE", relativePath, handlers)
 }
 
 // PATCH is a shortcut for router.Handle("PATCH", path, handle).
-func (group *RouterGroup) PATCH(relativePath string, handlers ...RouterHandler) IRoutes {
+func (group *RouterGroup) PATCH(relativePath string, handlers ...RouterHandler) *Route {
 	return group.handle("PATCH", relativePath, handlers)
 }
 
 // PUT is a shortcut for router.Handle("PUT", path, handle).
-func (group *RouterGroup) PUT(relativePath string, handlers ...RouterHandler) IRoutes {
+func (group *RouterGroup) PUT(relativePath string, handlers ...RouterHandler) *Route {
 	return group.handle("PUT", relativePath, handlers)
 }
 
 // OPTIONS is a shortcut for router.Handle("OPTIONS", path, handle).
-func (group *RouterGroup) OPTIONS(relativePath string, handlers ...RouterHandler) IRoutes {
+func (group *RouterGroup) OPTIONS(relativePath string, handlers ...RouterHandler) *Route {
 	return group.handle("OPTIONS", relativePath, handlers)
 }
 
 // HEAD is a shortcut for router.Handle("HEAD", path, handle).
-func (group *RouterGroup) HEAD(relativePath string, handlers ...RouterHandler) IRoutes {
+func (group *RouterGroup) HEAD(relativePath string, handlers ...RouterHandler) *Route {
 	return group.handle("HEAD", relativePath, handlers)
 }
 
 // Any registers a route that matches all the HTTP methods.
 // GET, POST, PUT, PATCH, HEAD, OPTIONS, DELETE, CONNECT, TRACE.
-func (group *RouterGroup) Any(relativePath string, handlers ...RouterHandler) IRoutes {
-	group.handle("GET", relativePath, handlers)
-	group.handle("POST", relativePath, handlers)
-	group.handle("PUT", relativePath, handlers)
-	group.handle("PATCH", relativePath, handlers)
-	group.handle("HEAD", relativePath, handlers)
-	group.handle("OPTIONS", relativePath, handlers)
-	group.handle("DELETE", relativePath, handlers)
-	group.handle("CONNECT", relativePath, handlers)
-	group.handle("TRACE", relativePath, handlers)
-	return group.returnObj()
+func (group *RouterGroup) Any(relativePath string, handlers ...RouterHandler) *Route {
+	route := group.route()
+	for _, method := range []string{"GET", "POST", "PUT", "PATCH", "HEAD", "OPTIONS", "DELETE", "CONNECT", "TRACE"} {
+		route.routes = append(route.routes, group.handle(method, relativePath, handlers).routes...)
+	}
+	return route
 }
 
 func (group *RouterGroup) combineHandlers(handlers RouterHandlerChain) RouterHandlerChain {
@@ -0,0 +1,146 @@
+package core
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"runtime"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RouteInfo describes a registered route.
+type RouteInfo struct {
+	Method      string            // http method
+	Host        string            // host pattern given to Host, empty for the default routes
+	Path        string            // full path, with :param and *catchAll segments
+	Constraints map[string]string // constraints of the params, e.g. {"id": "int"}
+	Name        string            // route name given by Name, may be empty
+	Version     string            // api version of the route, see Versioning
+	Handler     string            // name of the last handler
+	Middlewares []string          // names of the group middlewares and the route middlewares
+	Doc         *RouteDoc
+	handlers    RouterHandlerChain
+}
+
+// Routes returns all the registered routes, in registration order.
+func (engine *Engine) Routes() []RouteInfo {
+	routes := make([]RouteInfo, len(engine.routes))
+	for i, r := range engine.routes {
+		routes[i] = *r
+	}
+	return routes
+}
+
+// Route is the handle of the routes registered by a Handle, GET, POST... call, so that they can be named and documented:
+//
+//	router.GET("/user/:id", handler).Name("user.show")
+//
+// Its IRoutes methods register other routes, like the router it was returned by.
+type Route struct {
+	IRoutes
+	engine *Engine
+	routes []*RouteInfo
+}
+
+// Name names the routes, so that Routers.URL can build their paths.
+func (r *Route) Name(name string) *Route {
+	assert1(len(r.routes) > 0, "no route to name "+name)
+	_, exists := r.engine.namedRoutes[name]
+	assert1(exists == false, "route name "+name+" is already used")
+	for _, info := range r.routes {
+		info.Name = name
+	}
+	if r.engine.namedRoutes == nil {
+		r.engine.namedRoutes = make(map[string]*RouteInfo)
+	}
+	r.engine.namedRoutes[name] = r.routes[0]
+	return r
+}
+
+// URL builds the path of the route named name, params are the values of its :param and *catchAll segments, in order.
+//
+//	Routers.GET("/user/:id/*file", handler).Name("user.file")
+//	Routers.URL("user.file", 42, "a b/c.png") // "/user/42/a%20b/c.png"
+func (engine *Engine) URL(name string, params ...interface{}) (string, error) {
+	r, ok := engine.namedRoutes[name]
+	if ok == false {
+		return "", fmt.Errorf("route %s is not found", name)
+	}
+	var b strings.Builder
+	path := r.Path
+	n := 0
+	for len(path) > 0 {
+		i := strings.IndexAny(path, ":*")
+		if i < 0 {
+			b.WriteString(path)
+			break
+		}
+		b.WriteString(path[:i])
+		end := strings.IndexByte(path[i:], '/')
+		if end < 0 {
+			end = len(path)
+		} else {
+			end += i
+		}
+		if n >= len(params) {
+			return "", fmt.Errorf("route %s: missing value of %s", name, path[i:end])
+		}
+		value := fmt.Sprint(params[n])
+		n++
+		if path[i] == '*' {
+			segments := strings.Split(strings.TrimPrefix(value, "/"), "/")
+			for j := range segments {
+				segments[j] = url.PathEscape(segments[j])
+			}
+			b.WriteString(strings.Join(segments, "/"))
+		} else {
+			if value == "" {
+				return "", fmt.Errorf("route %s: value of %s is empty", name, path[i:end])
+			}
+			b.WriteString(url.PathEscape(value))
+		}
+		path = path[end:]
+	}
+	if n < len(params) {
+		return "", fmt.Errorf("route %s: too many params", name)
+	}
+	return b.String(), nil
+}
+
+func (engine *Engine) addRouteInfo(method, path string, constraints []paramConstraint, handlers RouterHandlerChain) *RouteInfo {
+	r := &RouteInfo{
+		Method:   method,
+		Host:     engine.host,
+		Path:     path,
+		Handler:  handlerName(handlers[len(handlers)-1]),
+		handlers: handlers,
+	}
+	for _, c := range constraints {
+		if r.Constraints == nil {
+			r.Constraints = make(map[string]string)
+		}
+		r.Constraints[c.param] = c.spec
+	}
+	for _, h := range handlers[:len(handlers)-1] {
+		r.Middlewares = append(r.Middlewares, handlerName(h))
+	}
+	engine.routes = append(engine.routes, r)
+	return r
+}
+
+// printRoutes logs the route table.
+func (engine *Engine) printRoutes() {
+	for _, r := range engine.routes {
+		name := ""
+		if r.Name != "" {
+			name = " [" + r.Name + "]"
+		}
+		log.Infof("%-7s %-40s --> %s (%d handlers)%s", r.Method, r.Host+r.Path, r.Handler, len(r.handlers), name)
+	}
+}
+
+func handlerName(h RouterHandler) string {
+	return runtime.FuncForPC(reflect.ValueOf(h).Pointer()).Name()
+}
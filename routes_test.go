@@ -0,0 +1,59 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func showUser(c *Context) {}
+
+func TestRoutes(t *testing.T) {
+	engine := create()
+	api := engine.Group("/api", principalAs("1"))
+	api.GET("/users/:id", showUser).Name("user.show")
+	engine.Any("/ping", func(c *Context) {}).Name("ping")
+
+	routes := engine.Routes()
+	if len(routes) != 10 {
+		t.Fatalf("routes: want 10, got %d", len(routes))
+	}
+	r := routes[0]
+	if r.Method != "GET" || r.Path != "/api/users/:id" || r.Name != "user.show" || strings.HasSuffix(r.Handler, ".showUser") == false {
+		t.Errorf("route: got %+v", r)
+	}
+	if len(r.Middlewares) != 1 || strings.Contains(r.Middlewares[0], "principalAs") == false {
+		t.Errorf("middlewares: got %v", r.Middlewares)
+	}
+	for _, r := range routes[1:] {
+		if r.Name != "ping" {
+			t.Errorf("%s %s: want name ping, got %q", r.Method, r.Path, r.Name)
+		}
+	}
+}
+
+func TestURL(t *testing.T) {
+	engine := create()
+	engine.GET("/users/:id", showUser).Name("user.show")
+	engine.GET("/files/:dir/*file", showUser).Name("file").GET("/about", showUser).Name("about")
+
+	tests := []struct {
+		name   string
+		params []interface{}
+		want   string
+		err    bool
+	}{
+		{"user.show", []interface{}{42}, "/users/42", false},
+		{"user.show", []interface{}{"张 三"}, "/users/%E5%BC%A0%20%E4%B8%89", false},
+		{"file", []interface{}{"a/b", "/x y/z.png"}, "/files/a%2Fb/x%20y/z.png", false},
+		{"user.show", nil, "", true},
+		{"user.show", []interface{}{1, 2}, "", true},
+		{"about", nil, "/about", false},
+		{"unknown", nil, "", true},
+	}
+	for _, tt := range tests {
+		got, err := engine.URL(tt.name, tt.params...)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("URL(%q, %v): want %q, got %q (%v)", tt.name, tt.params, tt.want, got, err)
+		}
+	}
+}
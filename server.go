@@ -9,6 +9,7 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"os"
+	"sync"
 	"time"
 
 	"gopkg.in/tylerb/graceful.v1"
@@ -27,8 +28,12 @@ var (
 	// beforeRun stores a set of functions that are triggered just before running the server.
 	beforeRun []func()
 
+	// parseFlagsOnce and useRoutersOnce let Serve be called again after the server stopped.
+	parseFlagsOnce sync.Once
+	useRoutersOnce sync.Once
+
 	// Timeout is the duration to allow outstanding requests to survive
-	// before forcefully terminating them.
+	// before forcefully terminating them on shutdown, 0 waits for all of them.
 	Timeout = 30 * time.Second
 
 	// ListenLimit Limit the number of outstanding requests
@@ -49,6 +54,10 @@ var (
 	// MultipartMaxmemoryMb Maximum size of memory that can be used when receiving uploaded files
 	MultipartMaxmemoryMb int
 
+	// MaxBodyBytes Maximum size of a request body, a PayloadTooLargeError is responded beyond, default is 0, no limit.
+	// BodyLimit sets the limit of a route.
+	MaxBodyBytes int64
+
 	// MaxHeaderBytes Max HTTP Herder size, default is 0, no limit
 	MaxHeaderBytes = 1 << 20
 )
@@ -56,37 +65,70 @@ var (
 func init() {
 }
 
-// BeforeRun adds a function that will be triggered just before running the server.
+// BeforeRun adds a function that will be triggered just before running the server, before the flags are parsed.
+// See OnInit for the hooks depending on the flags.
 func BeforeRun(f func()) {
 	beforeRun = append(beforeRun, f)
 }
 
-// Run starts the server for listening and serving.
+// Run starts the server for listening and serving, it exits if the server can not start.
 func Run() {
+	if err := Serve(); err != nil {
+		log.Fatalln(err)
+	}
+	log.Warnln("Server stoped.")
+}
+
+// Serve starts the server for listening and serving, and blocks until it is stopped by SIGINT, SIGTERM or Stop.
+// The lifecycle hooks are triggered in order, the error of a failing OnInit or OnStart hook is returned without serving.
+func Serve() error {
 	for _, f := range beforeRun {
 		f()
 	}
 
 	// parse command line params.
 	if OpenCommandLine {
-		flag.StringVar(&Address, "address", ":8080", "-address=:8080")
-		flag.BoolVar(&Production, "production", false, "-production=false")
-		flag.Parse()
+		parseFlagsOnce.Do(func() {
+			flag.StringVar(&Address, "address", ":8080", "-address=:8080")
+			flag.BoolVar(&Production, "production", false, "-production=false")
+			flag.Parse()
+		})
 	}
 
-	log.Warnln(fmt.Sprintf("Serving %s with pid %d. Production is %t.", Address, os.Getpid(), Production))
+	if err := runInitHooks(); err != nil {
+		return err
+	}
 
 	// set default router.
-	Use(Routers.handlers)
+	useRoutersOnce.Do(func() {
+		Use(Routers.handlers)
+	})
+	if Production == false {
+		Routers.printRoutes()
+	}
+
+	l, err := net.Listen("tcp", Address)
+	if err != nil {
+		return err
+	}
+	addr := l.Addr().String()
+	log.Warnln(fmt.Sprintf("Serving %s with pid %d. Production is %t.", addr, os.Getpid(), Production))
 
 	// set graceful server.
+	shutdownDone := make(chan struct{})
 	srv := &graceful.Server{
+		Timeout:     Timeout,
 		ListenLimit: ListenLimit,
 		ConnState: func(conn net.Conn, state http.ConnState) {
 			// conn has a new state
 		},
+		ShutdownInitiated: func() {
+			setRunning(nil)
+			runShutdownHooks()
+			close(shutdownDone)
+		},
 		Server: &http.Server{
-			Addr:           Address,
+			Addr:           addr,
 			Handler:        defaultHandlersStack,
 			ReadTimeout:    ReadTimeout,
 			WriteTimeout:   WriteTimeout,
@@ -94,11 +136,18 @@ func Run() {
 			MaxHeaderBytes: MaxHeaderBytes,
 		},
 	}
-	err := srv.ListenAndServe()
-
-	if err != nil {
-		log.Fatalln(err)
+	setRunning(srv)
+	defer setRunning(nil)
+	if err = runStartHooks(addr); err != nil {
+		l.Close()
+		return err
 	}
-	log.Warnln("Server stoped.")
+	err = srv.Serve(l)
 
+	// Serve returns nil once shut down, wait for the OnShutdown hooks.
+	if err == nil {
+		<-shutdownDone
+	}
+	runStopHooks()
+	return err
 }
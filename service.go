@@ -9,3 +9,8 @@ type IService interface {
 type Service struct {
 	Validate *Validation
 }
+
+// Err return a service error
+func (s *Service) Err(errno int, message string) error {
+	return (&BusinessError{}).New(errno, message)
+}
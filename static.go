@@ -0,0 +1,255 @@
+package core
+
+import (
+	"fmt"
+	"html"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StaticConfig configures the static routes, see RouterGroup.Static.
+type StaticConfig struct {
+	Index         string            // file served for the directories, default is "index.html"
+	Browse        bool              // list the directories without index
+	SPA           bool              // serve the root index for the paths not found, for single page apps
+	Precompressed bool              // serve the .br or .gz variant of a file if the client accepts it
+	MaxAge        time.Duration     // Cache-Control max-age, files are revalidated on each request if zero
+	Headers       map[string]string // response headers, they override the default headers
+	Dotfiles      bool              // serve the files and directories whose name starts with ".", e.g. .well-known
+}
+
+// Static serves the files of the root directory under the relative path:
+//
+//	router.Static("/assets", "./public", core.StaticConfig{MaxAge: 24 * time.Hour, Precompressed: true})
+//
+// The responses have ETag and Last-Modified headers, conditional and Range requests are supported.
+func (group *RouterGroup) Static(relativePath, root string, cfg ...StaticConfig) *Route {
+	return group.StaticFS(relativePath, http.Dir(root), cfg...)
+}
+
+// StaticFS serves the files of fs under the relative path, e.g. assets embedded in the binary.
+func (group *RouterGroup) StaticFS(relativePath string, fs http.FileSystem, cfg ...StaticConfig) *Route {
+	assert1(strings.ContainsAny(relativePath, ":*") == false, "static path can not have params")
+	s := newStaticServer(fs, cfg)
+	return group.getAndHead(joinPaths(relativePath, "/*filepath"), func(ctx *Context) {
+		s.serve(ctx, path.Clean("/"+ctx.Param("filepath")))
+	})
+}
+
+// StaticFile serves a single file at the relative path.
+func (group *RouterGroup) StaticFile(relativePath, file string, cfg ...StaticConfig) *Route {
+	assert1(strings.ContainsAny(relativePath, ":*") == false, "static path can not have params")
+	s := newStaticServer(http.Dir(filepath.Dir(file)), cfg)
+	s.Dotfiles = true // the file is chosen by the route
+	name := "/" + filepath.Base(file)
+	return group.getAndHead(relativePath, func(ctx *Context) {
+		s.serve(ctx, name)
+	})
+}
+
+// getAndHead registers the handler for GET and HEAD, both routes are named and documented together.
+func (group *RouterGroup) getAndHead(relativePath string, handler RouterHandler) *Route {
+	route := group.handle("GET", relativePath, RouterHandlerChain{handler})
+	route.routes = append(route.routes, group.handle("HEAD", relativePath, RouterHandlerChain{handler}).routes...)
+	return route
+}
+
+type staticServer struct {
+	StaticConfig
+	fs http.FileSystem
+}
+
+func newStaticServer(fs http.FileSystem, cfg []StaticConfig) *staticServer {
+	s := &staticServer{fs: fs}
+	if len(cfg) > 0 {
+		s.StaticConfig = cfg[0]
+	}
+	if s.Index == "" {
+		s.Index = "index.html"
+	}
+	return s
+}
+
+// serve responds the file of the cleaned name.
+func (s *staticServer) serve(ctx *Context, name string) {
+	if s.Dotfiles == false && hasDotSegment(name) {
+		ctx.Fail((&NotFoundError{}).New("File not found"))
+		return
+	}
+	f, err := s.fs.Open(name)
+	if err != nil {
+		s.notFound(ctx, name)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		ctx.Fail(err)
+		return
+	}
+
+	if info.IsDir() {
+		// Relative links of the directory need the trailing slash.
+		if strings.HasSuffix(ctx.Request.URL.Path, "/") == false {
+			u := *ctx.Request.URL
+			u.Path += "/"
+			ctx.Redirect(u.String(), http.StatusMovedPermanently)
+			return
+		}
+		index := path.Join(name, s.Index)
+		if fi, err := s.fs.Open(index); err == nil {
+			fi.Close()
+			s.serve(ctx, index)
+			return
+		}
+		if s.Browse == false {
+			s.notFound(ctx, name)
+			return
+		}
+		s.list(ctx, f)
+		return
+	}
+
+	h := ctx.ResponseWriter.Header()
+	h.Del("Content-Type")
+	if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+		h.Set("Content-Type", ct)
+	}
+	content, etag := http.File(f), fileETag(info)
+	if s.Precompressed {
+		if cf, cinfo, enc := s.precompressed(ctx.Request, name); cf != nil {
+			defer cf.Close()
+			content, info, etag = cf, cinfo, fileETag(cinfo)
+			h.Set("Content-Encoding", enc)
+			if h.Get("Content-Type") == "" {
+				h.Set("Content-Type", "application/octet-stream")
+			}
+		}
+		h.Add("Vary", "Accept-Encoding")
+	}
+	h.Set("ETag", etag)
+	if s.MaxAge > 0 {
+		h.Set("Cache-Control", "public, max-age="+strconv.FormatInt(int64(s.MaxAge/time.Second), 10))
+	} else {
+		h.Set("Cache-Control", "no-cache")
+	}
+	for k, v := range s.Headers {
+		h.Set(k, v)
+	}
+	http.ServeContent(ctx.ResponseWriter, ctx.Request, name, info.ModTime(), content)
+}
+
+// precompressed returns the .br or .gz variant of the file accepted by the client.
+func (s *staticServer) precompressed(r *http.Request, name string) (http.File, os.FileInfo, string) {
+	accept := r.Header.Get("Accept-Encoding")
+	for _, v := range []struct{ enc, ext string }{{"br", ".br"}, {"gzip", ".gz"}} {
+		if acceptQ(accept, v.enc) <= 0 {
+			continue
+		}
+		f, err := s.fs.Open(name + v.ext)
+		if err != nil {
+			continue
+		}
+		if info, err := f.Stat(); err == nil && info.IsDir() == false {
+			return f, info, v.enc
+		}
+		f.Close()
+	}
+	return nil, nil, ""
+}
+
+// notFound serves the root index for single page apps, or responds a NotFoundError.
+func (s *staticServer) notFound(ctx *Context, name string) {
+	index := "/" + s.Index
+	if s.SPA && name != index && path.Ext(name) == "" {
+		if f, err := s.fs.Open(index); err == nil {
+			f.Close()
+			s.serve(ctx, index)
+			return
+		}
+	}
+	ctx.Fail((&NotFoundError{}).New("File not found"))
+}
+
+// list responds the html listing of the directory.
+func (s *staticServer) list(ctx *Context, dir http.File) {
+	infos, err := dir.Readdir(-1)
+	if err != nil {
+		ctx.Fail(err)
+		return
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	h := ctx.ResponseWriter.Header()
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	for k, v := range s.Headers {
+		h.Set(k, v)
+	}
+	ctx.ResponseWriter.WriteHeader(http.StatusOK)
+	fmt.Fprintln(ctx.ResponseWriter, "<pre>")
+	for _, info := range infos {
+		name := info.Name()
+		if s.Dotfiles == false && strings.HasPrefix(name, ".") {
+			continue
+		}
+		if info.IsDir() {
+			name += "/"
+		}
+		u := url.URL{Path: name}
+		fmt.Fprintf(ctx.ResponseWriter, "<a href=\"%s\">%s</a>\n", u.String(), html.EscapeString(name))
+	}
+	fmt.Fprintln(ctx.ResponseWriter, "</pre>")
+}
+
+// hasDotSegment tells if a segment of the path starts with ".", e.g. /.git/config or /.env.
+func hasDotSegment(name string) bool {
+	for _, segment := range strings.Split(name, "/") {
+		if strings.HasPrefix(segment, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// fileETag returns an ETag made of the size and the modification time of the file.
+// It is strong so that http.ServeContent honors If-Range and resumes the downloads.
+func fileETag(info os.FileInfo) string {
+	return `"` + strconv.FormatInt(info.Size(), 16) + "-" + strconv.FormatInt(info.ModTime().UnixNano(), 16) + `"`
+}
+
+// acceptQ returns the quality of the token in an Accept-Encoding like header, "*" matches any token.
+func acceptQ(header, token string) float64 {
+	q, wildcard := -1.0, -1.0
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		value := 1.0
+		for _, p := range fields[1:] {
+			if kv := strings.SplitN(strings.TrimSpace(p), "=", 2); len(kv) == 2 && kv[0] == "q" {
+				if f, err := strconv.ParseFloat(kv[1], 64); err == nil {
+					value = f
+				}
+			}
+		}
+		switch name {
+		case token:
+			q = value
+		case "*":
+			wildcard = value
+		}
+	}
+	if q < 0 {
+		q = wildcard
+	}
+	if q < 0 {
+		return 0
+	}
+	return q
+}
@@ -0,0 +1,107 @@
+package core
+
+import (
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func staticDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"index.html":       "<h1>home</h1>",
+		"app.js":           "console.log('plain')",
+		"app.js.gz":        "gzipped",
+		"docs/readme.txt":  "0123456789",
+		"empty/.keep":      "",
+		"docs/guide/a.txt": "a",
+		".env":             "SECRET=1",
+		".git/config":      "[core]",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(p), 0755)
+		ioutil.WriteFile(p, []byte(content), 0644)
+	}
+	return dir
+}
+
+func TestStatic(t *testing.T) {
+	dir := staticDir(t)
+	defer os.RemoveAll(dir)
+	engine := create()
+	engine.Static("/assets", dir, StaticConfig{Precompressed: true, Browse: true, Headers: map[string]string{"X-Static": "1"}})
+	engine.Static("/app", dir, StaticConfig{SPA: true, MaxAge: 3600e9})
+	engine.StaticFile("/favicon.txt", filepath.Join(dir, "docs/readme.txt"))
+	engine.Static("/dot", dir, StaticConfig{Dotfiles: true})
+
+	tests := []struct {
+		path   string
+		header map[string]string
+		code   int
+		body   string
+		check  map[string]string
+	}{
+		{"/assets/docs/readme.txt", nil, 200, "0123456789", map[string]string{"Content-Type": "text/plain; charset=utf-8", "X-Static": "1", "Cache-Control": "no-cache"}},
+		{"/assets/docs/readme.txt", map[string]string{"Range": "bytes=2-4"}, 206, "234", map[string]string{"Content-Range": "bytes 2-4/10"}},
+		{"/assets/app.js", map[string]string{"Accept-Encoding": "gzip, br;q=0"}, 200, "gzipped", map[string]string{"Content-Encoding": "gzip", "Content-Type": mime.TypeByExtension(".js")}},
+		{"/assets/app.js", map[string]string{"Accept-Encoding": "gzip;q=0"}, 200, "console.log('plain')", map[string]string{"Content-Encoding": ""}},
+		{"/assets/", nil, 200, "<h1>home</h1>", nil},
+		{"/assets/docs", nil, 301, "", map[string]string{"Location": "/assets/docs/"}},
+		{"/assets/docs/", nil, 200, `<a href="guide/">guide/</a>`, nil},
+		{"/assets/../../etc/passwd", nil, 404, "File not found", nil},
+		{"/assets/missing", nil, 404, "File not found", nil},
+		{"/app/users/42", nil, 200, "<h1>home</h1>", map[string]string{"Cache-Control": "public, max-age=3600"}},
+		{"/app/missing.js", nil, 404, "File not found", nil},
+		{"/app/empty/", nil, 200, "<h1>home</h1>", nil},
+		{"/favicon.txt", nil, 200, "0123456789", nil},
+		{"/assets/.env", nil, 404, "File not found", nil},
+		{"/assets/.git/config", nil, 404, "File not found", nil},
+		{"/app/.git/config", nil, 404, "File not found", nil},
+		{"/dot/.env", nil, 200, "SECRET=1", nil},
+	}
+	for _, tt := range tests {
+		r, _ := http.NewRequest("GET", tt.path, nil)
+		for k, v := range tt.header {
+			r.Header.Set(k, v)
+		}
+		w := performRequest(engine, r)
+		if w.Code != tt.code || strings.Contains(w.Body.String(), tt.body) == false {
+			t.Errorf("%s: want %d %q, got %d %q", tt.path, tt.code, tt.body, w.Code, w.Body.String())
+		}
+		for k, v := range tt.check {
+			if got := w.Header().Get(k); got != v {
+				t.Errorf("%s: want %s %q, got %q", tt.path, k, v, got)
+			}
+		}
+	}
+
+	r, _ := http.NewRequest("GET", "/assets/docs/readme.txt", nil)
+	etag := performRequest(engine, r).Header().Get("ETag")
+	r.Header.Set("If-None-Match", etag)
+	if w := performRequest(engine, r); etag == "" || w.Code != http.StatusNotModified {
+		t.Errorf("want 304 for ETag %s, got %d", etag, w.Code)
+	}
+	r, _ = http.NewRequest("GET", "/assets/docs/readme.txt", nil)
+	r.Header.Set("Range", "bytes=5-")
+	r.Header.Set("If-Range", etag)
+	if w := performRequest(engine, r); w.Code != http.StatusPartialContent || w.Body.String() != "56789" {
+		t.Errorf("want the download resumed with If-Range, got %d %q", w.Code, w.Body.String())
+	}
+	r, _ = http.NewRequest("GET", "/assets/", nil)
+	os.Rename(filepath.Join(dir, "index.html"), filepath.Join(dir, "home.html"))
+	if w := performRequest(engine, r); strings.Contains(w.Body.String(), "home.html") == false || strings.Contains(w.Body.String(), ".env") || strings.Contains(w.Body.String(), ".git") {
+		t.Errorf("want the dotfiles hidden from the listing, got %s", w.Body.String())
+	}
+	r, _ = http.NewRequest("HEAD", "/favicon.txt", nil)
+	if w := performRequest(engine, r); w.Code != 200 || w.Body.Len() != 0 || w.Header().Get("Content-Length") != "10" {
+		t.Errorf("want HEAD without body, got %d %q", w.Code, w.Body.String())
+	}
+}
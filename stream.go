@@ -0,0 +1,207 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// errSSEClosed is returned when sending to a closed event stream.
+var errSSEClosed = errors.New("event stream is closed")
+
+// SSE is a Server-Sent Events stream, see Context.SSE.
+type SSE struct {
+	w           http.ResponseWriter
+	reqCtx      context.Context // context of the request, the Context is reused once the handler returns
+	lastEventID string
+	mu          sync.Mutex
+	closed      bool
+	stop        chan struct{} // closed by Close
+	done        chan struct{} // closed by Close or when the client goes away
+}
+
+// SSE starts a Server-Sent Events stream, it is closed when the handler returns:
+//
+//	sse, err := ctx.SSE()
+//	if err != nil {
+//		ctx.Fail(err)
+//		return
+//	}
+//	defer sse.Close()
+//	sse.Heartbeat(15 * time.Second)
+//	for {
+//		select {
+//		case msg := <-messages:
+//			sse.Send("message", msg.ID, msg)
+//		case <-sse.Done():
+//			return
+//		}
+//	}
+func (ctx *Context) SSE() (*SSE, error) {
+	if canFlush(ctx.ResponseWriter) == false {
+		return nil, errors.New("the response writer does not support flushing")
+	}
+	h := ctx.ResponseWriter.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	h.Set("X-Accel-Buffering", "no")
+	ctx.ResponseWriter.WriteHeader(http.StatusOK)
+	ctx.ResponseWriter.(http.Flusher).Flush()
+	s := &SSE{
+		w:           ctx.ResponseWriter,
+		reqCtx:      ctx.Request.Context(),
+		lastEventID: ctx.Request.Header.Get("Last-Event-ID"),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	ctx.streams = append(ctx.streams, s)
+	go func() {
+		select {
+		case <-s.reqCtx.Done():
+		case <-s.stop:
+		}
+		close(s.done)
+	}()
+	return s, nil
+}
+
+// LastEventID returns the id of the last event received by the client before it reconnected.
+func (s *SSE) LastEventID() string {
+	return s.lastEventID
+}
+
+// Done returns a channel closed when the client goes away or the stream is closed.
+func (s *SSE) Done() <-chan struct{} {
+	return s.done
+}
+
+// Retry tells the client to wait d before reconnecting.
+func (s *SSE) Retry(d time.Duration) error {
+	return s.write("retry: " + strconv.FormatInt(int64(d/time.Millisecond), 10) + "\n\n")
+}
+
+// Send sends an event, event and id are omitted if empty.
+// Strings and byte slices are sent as is, other data are JSON encoded.
+func (s *SSE) Send(event, id string, data interface{}) error {
+	var text string
+	switch d := data.(type) {
+	case string:
+		text = d
+	case []byte:
+		text = string(d)
+	default:
+		var json = jsoniter.ConfigCompatibleWithStandardLibrary
+		b, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		text = string(b)
+	}
+	var b strings.Builder
+	if event != "" {
+		b.WriteString("event: " + singleLine(event) + "\n")
+	}
+	if id != "" {
+		b.WriteString("id: " + singleLine(id) + "\n")
+	}
+	for _, line := range strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+	return s.write(b.String())
+}
+
+// Comment sends a comment, ignored by the client.
+func (s *SSE) Comment(text string) error {
+	return s.write(": " + singleLine(text) + "\n\n")
+}
+
+// Heartbeat sends a comment every interval until the stream is closed, so that proxies keep the connection open.
+func (s *SSE) Heartbeat(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if s.Comment("ping") != nil {
+					return
+				}
+			case <-s.done:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the heartbeat, the events sent afterwards return an error.
+// The streams not closed by the handler are closed when it returns.
+func (s *SSE) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed == false {
+		s.closed = true
+		close(s.stop)
+	}
+}
+
+func (s *SSE) write(text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errSSEClosed
+	}
+	if err := s.reqCtx.Err(); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(s.w, text); err != nil {
+		return err
+	}
+	s.w.(http.Flusher).Flush()
+	return nil
+}
+
+// singleLine removes the line breaks that would end an event field.
+func singleLine(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
+
+// Stream writes a chunked response: step is called until it returns false or the client goes away,
+// the response is flushed after each call. It returns true if the client went away.
+//
+//	ctx.Stream(func(w io.Writer) bool {
+//		row, ok := <-rows
+//		if ok {
+//			fmt.Fprintln(w, row)
+//		}
+//		return ok
+//	})
+func (ctx *Context) Stream(step func(w io.Writer) bool) bool {
+	done := ctx.Request.Context().Done()
+	var flusher http.Flusher
+	if canFlush(ctx.ResponseWriter) {
+		flusher = ctx.ResponseWriter.(http.Flusher)
+	}
+	for {
+		select {
+		case <-done:
+			return true
+		default:
+			keep := step(ctx.ResponseWriter)
+			if flusher != nil {
+				flusher.Flush()
+			}
+			if keep == false {
+				return false
+			}
+		}
+	}
+}
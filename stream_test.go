@@ -0,0 +1,148 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestContextWriterInterfaces(t *testing.T) {
+	hs := NewHandlersStack()
+	hs.Use(func(c *Context) {
+		if _, ok := c.ResponseWriter.(http.Flusher); ok == false {
+			t.Error("want http.Flusher")
+		}
+		if _, ok := c.ResponseWriter.(io.ReaderFrom); ok == false {
+			t.Error("want io.ReaderFrom")
+		}
+		if _, _, err := c.ResponseWriter.(http.Hijacker).Hijack(); err == nil {
+			t.Error("want hijack error from a recorder")
+		}
+		c.ResponseWriter.(io.ReaderFrom).ReadFrom(strings.NewReader("copied"))
+	})
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	hs.ServeHTTP(w, r)
+	if w.Body.String() != "copied" {
+		t.Errorf("want copied, got %s", w.Body.String())
+	}
+}
+
+// plainWriter hides the optional interfaces of the writer.
+type plainWriter struct {
+	http.ResponseWriter
+}
+
+func TestSSENotFlushable(t *testing.T) {
+	hs := NewHandlersStack()
+	hs.Use(func(c *Context) {
+		if _, err := c.SSE(); err == nil {
+			t.Error("want an error behind a writer not flushing")
+		}
+		c.WrapWriter(func(w http.ResponseWriter) http.ResponseWriter { return &compressWriter{ResponseWriter: w} })
+		if _, err := c.SSE(); err == nil {
+			t.Error("want an error behind wrappers of a writer not flushing")
+		}
+		c.ResponseWriter.(http.Flusher).Flush()
+		if c.Written() {
+			t.Error("want not written by a flush doing nothing")
+		}
+	})
+	r, _ := http.NewRequest("GET", "/", nil)
+	hs.ServeHTTP(plainWriter{httptest.NewRecorder()}, r)
+}
+
+func TestSSE(t *testing.T) {
+	hs := NewHandlersStack()
+	hs.Use(func(c *Context) {
+		sse, err := c.SSE()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sse.Close()
+		sse.Retry(3 * time.Second)
+		sse.Send("greet", "1", "hello\nworld")
+		sse.Send("", "", struct {
+			N int `json:"n"`
+		}{2})
+		if sse.LastEventID() != "7" {
+			t.Errorf("want Last-Event-ID 7, got %s", sse.LastEventID())
+		}
+	})
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Last-Event-ID", "7")
+	w := httptest.NewRecorder()
+	hs.ServeHTTP(w, r)
+
+	want := "retry: 3000\n\nevent: greet\nid: 1\ndata: hello\ndata: world\n\ndata: {\"n\":2}\n\n"
+	if w.Body.String() != want {
+		t.Errorf("want %q, got %q", want, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("want text/event-stream, got %s", ct)
+	}
+}
+
+func TestSSEDisconnect(t *testing.T) {
+	reqCtx, cancel := context.WithCancel(context.Background())
+	sent := make(chan error, 1)
+	hs := NewHandlersStack()
+	hs.Use(func(c *Context) {
+		sse, _ := c.SSE()
+		defer sse.Close()
+		cancel()
+		<-sse.Done()
+		sent <- sse.Send("", "", "late")
+	})
+	r, _ := http.NewRequest("GET", "/", nil)
+	hs.ServeHTTP(httptest.NewRecorder(), r.WithContext(reqCtx))
+	if err := <-sent; err == nil {
+		t.Error("want error sending after the client went away")
+	}
+}
+
+func TestSSEClosedOnReturn(t *testing.T) {
+	var sse *SSE
+	hs := NewHandlersStack()
+	hs.Use(func(c *Context) {
+		sse, _ = c.SSE()
+		sse.Heartbeat(time.Millisecond)
+	})
+	r, _ := http.NewRequest("GET", "/", nil)
+	hs.ServeHTTP(httptest.NewRecorder(), r)
+
+	select {
+	case <-sse.Done():
+	case <-time.After(time.Second):
+		t.Fatal("want the stream closed when the handler returns")
+	}
+	if err := sse.Comment("ping"); err != errSSEClosed {
+		t.Errorf("want %v, got %v", errSSEClosed, err)
+	}
+}
+
+func TestStream(t *testing.T) {
+	hs := NewHandlersStack()
+	hs.Use(func(c *Context) {
+		i := 0
+		gone := c.Stream(func(w io.Writer) bool {
+			i++
+			fmt.Fprintf(w, "%d;", i)
+			return i < 3
+		})
+		if gone {
+			t.Error("want stream to end by step")
+		}
+	})
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	hs.ServeHTTP(w, r)
+	if w.Body.String() != "1;2;3;" || w.Flushed == false {
+		t.Errorf("want flushed 1;2;3;, got %q %v", w.Body.String(), w.Flushed)
+	}
+}
@@ -357,6 +357,31 @@ func (n *node) insertChild(numParams uint8, path string, fullPath string, handle
 	n.handlers = handlers
 }
 
+// leaf returns the node holding the handle of the registered path, nil if the path is not registered.
+func (n *node) leaf(path string) *node {
+walk:
+	for {
+		if len(path) < len(n.path) || path[:len(n.path)] != n.path {
+			return nil
+		}
+		path = path[len(n.path):]
+		if path == "" {
+			return n
+		}
+		if n.wildChild {
+			n = n.children[0]
+			continue walk
+		}
+		for i := 0; i < len(n.indices); i++ {
+			if path[0] == n.indices[i] {
+				n = n.children[i]
+				continue walk
+			}
+		}
+		return nil
+	}
+}
+
 // getValue returns the handle registered with the given path (key). The values of
 // wildcards are saved to a map.
 // If no handle can be found, a TSR (trailing slash redirect) recommendation is
@@ -0,0 +1,266 @@
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	jsoniter "github.com/json-iterator/go"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+// typedSignature is the signature of a typed handler, computed at registration time.
+type typedSignature struct {
+	fn       reflect.Value
+	in       reflect.Type // request struct type, nil if the handler has no input
+	out      reflect.Type // response type, nil if the handler only returns an error
+	fields   []bindField
+	hasValue bool // the handler returns a value besides the error
+}
+
+// bindField binds a request struct field from the path params, the query or the form.
+type bindField struct {
+	index []int
+	name  string
+	kind  reflect.Kind
+	def   string // default tag
+}
+
+var (
+	contextType = reflect.TypeOf(&Context{})
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+
+	typedValidate     *validator.Validate
+	typedValidateOnce sync.Once
+)
+
+// Typed adapts a typed handler to a RouterHandler. Its signature must be one of:
+//
+//	func(ctx *Context, in *Req) (*Resp, error)
+//	func(ctx *Context, in *Req) error
+//	func(ctx *Context) (*Resp, error)
+//
+// Req is bound from the path params, the query, and the JSON or form body of POST, PUT and PATCH requests,
+// its default tags are applied, then it is validated with its validate tags and a ValidationError is responded on failure.
+// The returned error is responded with Fail, and Resp with Ok.
+// The signature is checked with reflection when Typed is called. Register the handler with RouterGroup.Typed
+// so that its types are documented by the OpenAPI generator.
+func Typed(fn interface{}) RouterHandler {
+	return newTypedSignature(fn).handler()
+}
+
+// Typed registers the typed handler fn for the method and path, after the middlewares, see Typed.
+// The request and response types of fn document the route:
+//
+//	router.Typed("GET", "/orders/:id", getOrder, core.RequireRole("clerk")).Name("order.show")
+func (group *RouterGroup) Typed(httpMethod, relativePath string, fn interface{}, middlewares ...RouterHandler) *Route {
+	sig := newTypedSignature(fn)
+	handlers := append(RouterHandlerChain{}, middlewares...)
+	route := group.Handle(httpMethod, relativePath, append(handlers, sig.handler())...)
+	for _, info := range route.routes {
+		sig.describe(info)
+	}
+	return route
+}
+
+// handler returns the RouterHandler binding the request and calling the typed handler.
+func (sig *typedSignature) handler() RouterHandler {
+	return func(ctx *Context) {
+		args := []reflect.Value{reflect.ValueOf(ctx)}
+		if sig.in != nil {
+			in := reflect.New(sig.in)
+			if err := sig.bind(ctx, in); err != nil {
+				ctx.Fail(err)
+				return
+			}
+			args = append(args, in)
+		}
+		out := sig.fn.Call(args)
+		if err, _ := out[len(out)-1].Interface().(error); err != nil {
+			ctx.Fail(err)
+			return
+		}
+		if sig.hasValue {
+			ctx.Ok(out[0].Interface())
+		} else {
+			ctx.Ok(nil)
+		}
+	}
+}
+
+// describe sets the handler name and the request and response types of the route.
+func (sig *typedSignature) describe(r *RouteInfo) {
+	r.Handler = runtime.FuncForPC(sig.fn.Pointer()).Name()
+	r.Doc = &RouteDoc{}
+	if sig.in != nil {
+		r.Doc.Request = reflect.New(sig.in).Interface()
+	}
+	if sig.out != nil {
+		r.Doc.Response = reflect.New(sig.out).Elem().Interface()
+		if sig.out.Kind() == reflect.Ptr {
+			r.Doc.Response = reflect.New(sig.out.Elem()).Interface()
+		}
+	}
+}
+
+func newTypedSignature(fn interface{}) *typedSignature {
+	v := reflect.ValueOf(fn)
+	t := v.Type()
+	assert1(t.Kind() == reflect.Func, "typed handler must be a func")
+	name := t.String()
+	assert1(t.NumIn() == 1 || t.NumIn() == 2, "typed handler "+name+" must have 1 or 2 params")
+	assert1(t.In(0) == contextType, "first param of typed handler "+name+" must be *core.Context")
+	assert1(t.NumOut() == 1 || t.NumOut() == 2, "typed handler "+name+" must return an error or a value and an error")
+	assert1(t.Out(t.NumOut()-1) == errorType, "last result of typed handler "+name+" must be an error")
+
+	sig := &typedSignature{fn: v, hasValue: t.NumOut() == 2}
+	if sig.hasValue {
+		sig.out = t.Out(0)
+	}
+	if t.NumIn() == 2 {
+		in := t.In(1)
+		assert1(in.Kind() == reflect.Ptr && in.Elem().Kind() == reflect.Struct, "second param of typed handler "+name+" must be a pointer to a struct")
+		sig.in = in.Elem()
+		sig.fields = bindFields(sig.in, nil)
+	}
+	return sig
+}
+
+// bindFields returns the bindable fields of t, embedded structs are flattened.
+func bindFields(t reflect.Type, index []int) []bindField {
+	var fields []bindField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		idx := append(append([]int{}, index...), i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			fields = append(fields, bindFields(f.Type, idx)...)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		kind := f.Type.Kind()
+		if kind == reflect.Slice && f.Type.Elem().Kind() != reflect.String {
+			kind = reflect.Invalid // only JSON bodies can fill other slices
+		}
+		fields = append(fields, bindField{index: idx, name: name, kind: kind, def: f.Tag.Get("default")})
+	}
+	return fields
+}
+
+// bind fills in from the request and validates it.
+func (sig *typedSignature) bind(ctx *Context, in reflect.Value) error {
+	s := in.Elem()
+	for _, f := range sig.fields {
+		if f.def != "" {
+			if err := setField(s.FieldByIndex(f.index), f.kind, []string{f.def}); err != nil {
+				return (&ValidationError{}).New(fmt.Sprintf("%s: invalid default value", f.name))
+			}
+		}
+	}
+
+	r := ctx.Request
+	values := r.URL.Query()
+	switch r.Method {
+	case "POST", "PUT", "PATCH":
+		ct := strings.TrimSpace(strings.Split(r.Header.Get("Content-Type"), ";")[0])
+		switch ct {
+		case "application/x-www-form-urlencoded", "multipart/form-data":
+			if err := r.ParseMultipartForm(multipartMaxMemory()); err != nil && ct == "multipart/form-data" {
+				return (&ValidationError{}).New("invalid form body")
+			}
+			values = r.Form
+		default:
+			body, err := ctx.Body()
+			if err != nil {
+				return err
+			}
+			if len(body) > 0 {
+				var json = jsoniter.ConfigCompatibleWithStandardLibrary
+				if err = json.Unmarshal(body, in.Interface()); err != nil {
+					return (&ValidationError{}).New("invalid json body: " + err.Error())
+				}
+			}
+		}
+	}
+	for _, f := range sig.fields {
+		if f.kind == reflect.Invalid {
+			continue
+		}
+		v, ok := values[f.name]
+		if p, found := ctx.Params.Get(f.name); found {
+			v, ok = []string{p}, true
+		}
+		if ok == false {
+			continue
+		}
+		if err := setField(s.FieldByIndex(f.index), f.kind, v); err != nil {
+			return (&ValidationError{}).New(f.name + " is invalid")
+		}
+	}
+
+	typedValidateOnce.Do(func() {
+		typedValidate = validator.New()
+		typedValidate.RegisterTagNameFunc(func(f reflect.StructField) string {
+			return strings.Split(f.Tag.Get("json"), ",")[0]
+		})
+	})
+	if err := typedValidate.Struct(in.Interface()); err != nil {
+		if errs, ok := err.(validator.ValidationErrors); ok && len(errs) > 0 {
+			e := errs[0]
+			msg := e.Field() + " failed on " + e.Tag()
+			if e.Param() != "" {
+				msg += "=" + e.Param()
+			}
+			return (&ValidationError{}).New(msg)
+		}
+		return (&ValidationError{}).New(err.Error())
+	}
+	return nil
+}
+
+// setField converts the values to the kind of the field.
+func setField(f reflect.Value, kind reflect.Kind, values []string) error {
+	v := values[0]
+	switch kind {
+	case reflect.String:
+		f.SetString(v)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(v, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(v, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(v, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+	case reflect.Slice:
+		f.Set(reflect.ValueOf(append([]string{}, values...)))
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package core
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type orderQuery struct {
+	ID    int      `json:"id"`
+	Page  int      `json:"page" validate:"gte=1" default:"1"`
+	Sort  string   `json:"sort" validate:"omitempty,oneof=asc desc"`
+	Field []string `json:"field"`
+}
+
+type orderForm struct {
+	Product string `json:"product" validate:"required"`
+	Count   int    `json:"count" validate:"gte=1" default:"1"`
+}
+
+type order struct {
+	ID      int    `json:"id"`
+	Product string `json:"product"`
+	Count   int    `json:"count"`
+}
+
+func TestTyped(t *testing.T) {
+	engine := create()
+	engine.Typed("GET", "/orders/:id", func(c *Context, q *orderQuery) (*order, error) {
+		if q.ID == 404 {
+			return nil, (&NotFoundError{}).New("order not found")
+		}
+		return &order{ID: q.ID * q.Page, Product: strings.Join(q.Field, ",")}, nil
+	})
+	engine.Typed("POST", "/orders", func(c *Context, f *orderForm) (*order, error) {
+		return &order{ID: 1, Product: f.Product, Count: f.Count}, nil
+	})
+	engine.DELETE("/orders/:id", Typed(func(c *Context, q *orderQuery) error { return nil }))
+
+	tests := []struct {
+		method, url, contentType, body string
+		code                           int
+		want                           string
+	}{
+		{"GET", "/orders/2?field=a&field=b", "", "", 200, `"id":2,"product":"a,b"`},
+		{"GET", "/orders/2?page=3", "", "", 200, `"id":6`},
+		{"GET", "/orders/x", "", "", 400, `id is invalid`},
+		{"GET", "/orders/2?page=0", "", "", 400, `page failed on gte=1`},
+		{"GET", "/orders/2?sort=up", "", "", 400, `sort failed on oneof`},
+		{"GET", "/orders/404", "", "", 404, `order not found`},
+		{"POST", "/orders", "application/json", `{"product":"tea"}`, 200, `"product":"tea","count":1`},
+		{"POST", "/orders", "application/json", `{"product":"tea","count":3}`, 200, `"count":3`},
+		{"POST", "/orders", "application/x-www-form-urlencoded", `product=tea&count=2`, 200, `"count":2`},
+		{"POST", "/orders", "application/json", `{}`, 400, `product failed on required`},
+		{"POST", "/orders", "application/json", `{`, 400, `invalid json body`},
+		{"DELETE", "/orders/2", "", "", 200, `"ok":true`},
+	}
+	for _, tt := range tests {
+		r, _ := http.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+		if tt.contentType != "" {
+			r.Header.Set("Content-Type", tt.contentType)
+		}
+		w := performRequest(engine, r)
+		if w.Code != tt.code || strings.Contains(w.Body.String(), tt.want) == false {
+			t.Errorf("%s %s: want %d %s, got %d %s", tt.method, tt.url, tt.code, tt.want, w.Code, w.Body.String())
+		}
+	}
+
+	routes := engine.Routes()
+	if doc := routes[1].Doc; doc == nil || doc.Request == nil || doc.Response == nil {
+		t.Fatalf("want typed route documented, got %+v", doc)
+	}
+	if _, ok := routes[1].Doc.Request.(*orderForm); ok == false {
+		t.Errorf("want request *orderForm, got %T", routes[1].Doc.Request)
+	}
+	if _, ok := routes[1].Doc.Response.(*order); ok == false {
+		t.Errorf("want response *order, got %T", routes[1].Doc.Response)
+	}
+	if strings.HasSuffix(routes[1].Handler, "TestTyped.func2") == false {
+		t.Errorf("want handler TestTyped.func2, got %s", routes[1].Handler)
+	}
+}
+
+func TestTypedSignature(t *testing.T) {
+	invalid := []interface{}{
+		"handler",
+		func() error { return nil },
+		func(c *Context) {},
+		func(c *Context, q orderQuery) error { return nil },
+		func(c *Context) (*order, string) { return nil, "" },
+	}
+	for _, fn := range invalid {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("want panic for %T", fn)
+				}
+			}()
+			Typed(fn)
+		}()
+	}
+}
+
+func getOrder(c *Context, q *orderQuery) (*order, error) { return nil, nil }
+
+func TestTypedRoute(t *testing.T) {
+	engine := create()
+	engine.Typed("GET", "/orders/:id", getOrder, principalAs("1")).Name("order.show")
+	engine.Typed("POST", "/orders", func(c *Context, f *orderForm) error { return nil })
+	engine.PUT("/orders/:id", Typed(getOrder))
+
+	routes := engine.Routes()
+	if r := routes[0]; r.Name != "order.show" || strings.HasSuffix(r.Handler, ".getOrder") == false || len(r.Middlewares) != 1 ||
+		r.Doc == nil || reflect.TypeOf(r.Doc.Request) != reflect.TypeOf(&orderQuery{}) || reflect.TypeOf(r.Doc.Response) != reflect.TypeOf(&order{}) {
+		t.Errorf("query: want the orderQuery and order types, got %+v %+v", r, r.Doc)
+	}
+	if r := routes[1]; r.Doc == nil || reflect.TypeOf(r.Doc.Request) != reflect.TypeOf(&orderForm{}) || r.Doc.Response != nil {
+		t.Errorf("form: want the orderForm type, got %+v", r.Doc)
+	}
+	if r := routes[2]; r.Doc != nil {
+		t.Errorf("adapter: want no doc, got %+v", r.Doc)
+	}
+}
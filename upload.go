@@ -0,0 +1,430 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// UploadConfig limits the multipart uploads, see Upload.
+type UploadConfig struct {
+	MaxMemory    int64    // size of the files kept in memory by MultipartForm, the rest is stored in temp files, default is MultipartMaxmemoryMb
+	MaxBytes     int64    // max size of the request body, no limit if zero
+	MaxFileBytes int64    // max size of a file saved by PartReader.Save or returned by MultipartForm, no limit if zero
+	AllowedTypes []string // sniffed content types of the allowed files, a type ending with "/" matches all its subtypes, all allowed if empty
+}
+
+// DefaultUploadConfig is the config of the routes without Upload middleware.
+var DefaultUploadConfig = UploadConfig{}
+
+// Upload returns a middleware setting the upload config of the route:
+//
+//	router.POST("/avatars", core.Upload(core.UploadConfig{MaxBytes: 2 << 20, AllowedTypes: []string{"image/"}}), saveAvatar)
+func Upload(cfg UploadConfig) RouterHandler {
+	return func(ctx *Context) {
+		ctx.Data["core.upload"] = &cfg
+		ctx.Next()
+	}
+}
+
+// multipartMaxMemory returns the memory used to parse multipart forms.
+func multipartMaxMemory() int64 {
+	if MultipartMaxmemoryMb > 0 {
+		return int64(MultipartMaxmemoryMb) << 20
+	}
+	return 32 << 20
+}
+
+func (ctx *Context) uploadConfig() *UploadConfig {
+	if cfg, ok := ctx.Data["core.upload"].(*UploadConfig); ok {
+		return cfg
+	}
+	return &DefaultUploadConfig
+}
+
+// limitBody applies the MaxBytes of the upload config to the request body.
+func (ctx *Context) limitBody(cfg *UploadConfig) {
+	if cfg.MaxBytes > 0 {
+		ctx.setBodyLimit(cfg.MaxBytes)
+	}
+}
+
+// MultipartForm parses the multipart form of the request within the limits of the upload config.
+// A ValidationError is returned if a file has an unsafe name or a disallowed content type.
+// The files of a form already parsed, e.g. by Request.FormFile, are checked too.
+func (ctx *Context) MultipartForm() (*multipart.Form, error) {
+	r := ctx.Request
+	cfg := ctx.uploadConfig()
+	if r.MultipartForm == nil {
+		ctx.limitBody(cfg)
+		maxMemory := cfg.MaxMemory
+		if maxMemory <= 0 {
+			maxMemory = multipartMaxMemory()
+		}
+		if err := r.ParseMultipartForm(maxMemory); err != nil {
+			return nil, ctx.uploadError(err)
+		}
+	}
+	// The result of the checks is kept, the files are removed when they fail.
+	if err, checked := ctx.Data["core.upload.checked"]; checked {
+		if err != nil {
+			return nil, err.(error)
+		}
+		return r.MultipartForm, nil
+	}
+	err := cfg.checkForm(r.MultipartForm)
+	if err != nil {
+		r.MultipartForm.RemoveAll()
+		ctx.Data["core.upload.checked"] = err
+		return nil, err
+	}
+	ctx.Data["core.upload.checked"] = nil
+	return r.MultipartForm, nil
+}
+
+// checkForm checks the names, content types and sizes of the files of the form.
+func (cfg *UploadConfig) checkForm(form *multipart.Form) error {
+	var size int64
+	for _, files := range form.File {
+		for _, fh := range files {
+			size += fh.Size
+			if (cfg.MaxFileBytes > 0 && fh.Size > cfg.MaxFileBytes) || (cfg.MaxBytes > 0 && size > cfg.MaxBytes) {
+				return errEntityTooLarge()
+			}
+			if err := checkFileName(fh.Filename); err != nil {
+				return err
+			}
+			f, err := fh.Open()
+			if err != nil {
+				return err
+			}
+			head := make([]byte, 512)
+			n, _ := io.ReadFull(f, head)
+			f.Close()
+			if err = cfg.checkType(head[:n]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// FormFile returns the first file of the form field, see MultipartForm.
+func (ctx *Context) FormFile(name string) (*multipart.FileHeader, error) {
+	form, err := ctx.MultipartForm()
+	if err != nil {
+		return nil, err
+	}
+	if files := form.File[name]; len(files) > 0 {
+		return files[0], nil
+	}
+	return nil, (&ValidationError{}).New(name + " is required")
+}
+
+// SaveUploadedFile copies the uploaded file to dst, its directory is created if needed.
+func (ctx *Context) SaveUploadedFile(fh *multipart.FileHeader, dst string) error {
+	src, err := fh.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if err = os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, src); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
+
+// Storage stores the uploaded files streamed by PartReader.Save.
+type Storage interface {
+	// Save stores the content of r under name, and returns its location.
+	Save(name string, r io.Reader) (string, error)
+	// Delete removes the file stored under name.
+	Delete(name string) error
+}
+
+// UploadedFile describes a file saved by PartReader.Save.
+type UploadedFile struct {
+	Field       string // form field
+	Filename    string // name sent by the client
+	ContentType string // sniffed content type
+	Size        int64
+	Location    string // location returned by the storage
+}
+
+// PartReader iterates over the parts of a multipart request without buffering them:
+//
+//	parts, err := ctx.MultipartReader()
+//	if err != nil {
+//		ctx.Fail(err)
+//		return
+//	}
+//	for parts.Next() {
+//		if parts.Part().FileName() == "" {
+//			value, _ := parts.Value()
+//			continue
+//		}
+//		file, err := parts.Save(storage, uuid.New().String())
+//		...
+//	}
+//	if err := parts.Err(); err != nil {
+//		ctx.Fail(err)
+//	}
+type PartReader struct {
+	ctx  *Context
+	cfg  *UploadConfig
+	mr   *multipart.Reader
+	part *multipart.Part
+	err  error
+}
+
+// MultipartReader returns an iterator over the parts of the request, within the limits of the upload config.
+func (ctx *Context) MultipartReader() (*PartReader, error) {
+	cfg := ctx.uploadConfig()
+	ctx.limitBody(cfg)
+	mr, err := ctx.Request.MultipartReader()
+	if err != nil {
+		return nil, (&ValidationError{}).New("invalid multipart body")
+	}
+	return &PartReader{ctx: ctx, cfg: cfg, mr: mr}, nil
+}
+
+// Next moves to the next part, it returns false at the end of the body or on error.
+func (pr *PartReader) Next() bool {
+	if pr.err != nil {
+		return false
+	}
+	if pr.part != nil {
+		pr.part.Close()
+	}
+	pr.part, pr.err = pr.mr.NextPart()
+	if pr.err == io.EOF {
+		pr.err = nil
+		return false
+	}
+	if pr.err != nil {
+		pr.err = pr.ctx.uploadError(pr.err)
+		return false
+	}
+	return true
+}
+
+// Part returns the current part.
+func (pr *PartReader) Part() *multipart.Part {
+	return pr.part
+}
+
+// Err returns the error that stopped the iteration.
+func (pr *PartReader) Err() error {
+	return pr.err
+}
+
+// Value reads the current part as a form value, up to 1MB.
+func (pr *PartReader) Value() (string, error) {
+	b, err := ioutil.ReadAll(io.LimitReader(pr.part, 1<<20+1))
+	if err != nil {
+		return "", pr.fail(pr.ctx.uploadError(err))
+	}
+	if len(b) > 1<<20 {
+		return "", pr.fail((&ValidationError{}).New(pr.part.FormName() + " is too long"))
+	}
+	return string(b), nil
+}
+
+// Save streams the current part to the storage under name, checking its file name, content type and size.
+// The file is deleted from the storage if it exceeds MaxFileBytes.
+func (pr *PartReader) Save(storage Storage, name string) (*UploadedFile, error) {
+	p := pr.part
+	if err := checkFileName(p.FileName()); err != nil {
+		return nil, pr.fail(err)
+	}
+	head := make([]byte, 512)
+	n, err := io.ReadFull(p, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, pr.fail(pr.ctx.uploadError(err))
+	}
+	head = head[:n]
+	if err = pr.cfg.checkType(head); err != nil {
+		return nil, pr.fail(err)
+	}
+	file := &UploadedFile{Field: p.FormName(), Filename: p.FileName(), ContentType: http.DetectContentType(head)}
+	counter := &countingReader{r: io.MultiReader(bytes.NewReader(head), p), max: pr.cfg.MaxFileBytes}
+	file.Location, err = storage.Save(name, counter)
+	file.Size = counter.n
+	if counter.exceeded {
+		storage.Delete(name)
+		return nil, pr.fail(errEntityTooLarge())
+	}
+	if err != nil {
+		return nil, pr.fail(pr.ctx.uploadError(err))
+	}
+	return file, nil
+}
+
+// fail stops the iteration with err.
+func (pr *PartReader) fail(err error) error {
+	pr.err = err
+	return err
+}
+
+// countingReader counts the bytes read, and fails once max is exceeded.
+type countingReader struct {
+	r        io.Reader
+	n, max   int64
+	exceeded bool
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	if c.max > 0 && c.n > c.max {
+		c.exceeded = true
+		return n, errors.New("file too large")
+	}
+	return n, err
+}
+
+// DiskStorage stores the files in a directory.
+type DiskStorage struct {
+	Dir string
+}
+
+// Save writes the file, the name can contain sub directories.
+func (s DiskStorage) Save(name string, r io.Reader) (string, error) {
+	dst, err := s.path(name)
+	if err != nil {
+		return "", err
+	}
+	if err = os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", err
+	}
+	f, err := os.Create(dst)
+	if err != nil {
+		return "", err
+	}
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(dst)
+		return "", err
+	}
+	return dst, f.Close()
+}
+
+// Delete removes the file.
+func (s DiskStorage) Delete(name string) error {
+	dst, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(dst)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s DiskStorage) path(name string) (string, error) {
+	if ValidFilePath(ALLOW_RELATIVE_PATH).IsSatisfied(name) == false || strings.Contains(name, "..") {
+		return "", (&ValidationError{}).New(name + " is an invalid file path")
+	}
+	return filepath.Join(s.Dir, filepath.FromSlash(name)), nil
+}
+
+// MemoryStorage keeps the files in memory, for the tests.
+type MemoryStorage struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+// Save reads the file in memory.
+func (s *MemoryStorage) Save(name string, r io.Reader) (string, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.files == nil {
+		s.files = make(map[string][]byte)
+	}
+	s.files[name] = b
+	return name, nil
+}
+
+// Delete removes the file.
+func (s *MemoryStorage) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.files, name)
+	return nil
+}
+
+// File returns the content of the file saved under name.
+func (s *MemoryStorage) File(name string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.files[name]
+	return b, ok
+}
+
+// checkType checks the content type sniffed from the head of a file.
+func (cfg *UploadConfig) checkType(head []byte) error {
+	if len(cfg.AllowedTypes) == 0 {
+		return nil
+	}
+	ct := http.DetectContentType(head)
+	if matchMediaType(ct, cfg.AllowedTypes) == false {
+		return (&ValidationError{}).New("unsupported file type " + strings.Split(ct, ";")[0])
+	}
+	return nil
+}
+
+// checkFileName checks the base name of an uploaded file with the FilePath validator.
+func checkFileName(name string) error {
+	base := filepath.Base(strings.Replace(name, `\`, "/", -1))
+	if name == "" || ValidFilePath(ONLY_FILENAME).IsSatisfied(base) == false {
+		return (&ValidationError{}).New("file name is invalid")
+	}
+	return nil
+}
+
+// uploadError converts the errors of a too large body.
+func (ctx *Context) uploadError(err error) error {
+	if ctx.bodyTooLarge(err) {
+		return errEntityTooLarge()
+	}
+	if _, ok := err.(ICoreError); ok {
+		return err
+	}
+	return (&ValidationError{}).New("invalid multipart body")
+}
+
+func errEntityTooLarge() error {
+	return (&PayloadTooLargeError{}).New("upload is too large")
+}
+
+// matchMediaType tells if the media type of ct is one of types, a type ending with "/" matches all its subtypes.
+func matchMediaType(ct string, types []string) bool {
+	ct = strings.ToLower(strings.TrimSpace(strings.Split(ct, ";")[0]))
+	for _, t := range types {
+		if ct == t || strings.HasSuffix(t, "/") && strings.HasPrefix(ct, t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package core
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var pngHead = []byte("\x89PNG\r\n\x1a\n0000000000")
+
+// multipartRequest returns a POST request with the fields and the files, by field name.
+func multipartRequest(path string, fields map[string]string, files map[string][]byte, filename string) *http.Request {
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	for k, v := range files {
+		w, _ := mw.CreateFormFile(k, filename)
+		w.Write(v)
+	}
+	mw.Close()
+	r, _ := http.NewRequest("POST", path, body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return r
+}
+
+func TestFormFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "upload")
+	defer os.RemoveAll(dir)
+	engine := create()
+	engine.POST("/avatar", Upload(UploadConfig{MaxBytes: 1 << 10, AllowedTypes: []string{"image/"}}), func(c *Context) {
+		fh, err := c.FormFile("avatar")
+		if err != nil {
+			c.Fail(err)
+			return
+		}
+		if err = c.SaveUploadedFile(fh, filepath.Join(dir, "a", fh.Filename)); err != nil {
+			c.Fail(err)
+			return
+		}
+		c.Ok(fh.Filename)
+	})
+
+	tests := []struct {
+		file     []byte
+		filename string
+		code     int
+		want     string
+	}{
+		{pngHead, "me.png", 200, "me.png"},
+		{[]byte("plain text"), "me.png", 400, "unsupported file type text/plain"},
+		{append(pngHead, make([]byte, 2<<10)...), "big.png", 413, "upload is too large"},
+		{pngHead, "../../etc/me.png", 200, "me.png"},
+		{pngHead, "me<script>.png", 400, "file name is invalid"},
+	}
+	for _, tt := range tests {
+		r := multipartRequest("/avatar", nil, map[string][]byte{"avatar": tt.file}, tt.filename)
+		w := performRequest(engine, r)
+		if w.Code != tt.code || strings.Contains(w.Body.String(), tt.want) == false {
+			t.Errorf("%s: want %d %s, got %d %s", tt.filename, tt.code, tt.want, w.Code, w.Body.String())
+		}
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "a", "me.png")); err != nil || bytes.Equal(b, pngHead) == false {
+		t.Errorf("want saved file, got %q %v", b, err)
+	}
+}
+
+func TestFormFileParsed(t *testing.T) {
+	engine := create()
+	engine.POST("/avatar", Upload(UploadConfig{MaxFileBytes: 1 << 10, AllowedTypes: []string{"image/"}}), func(c *Context) {
+		c.Request.FormFile("avatar")
+		fh, err := c.FormFile("avatar")
+		if err != nil {
+			c.Fail(err)
+			return
+		}
+		c.Ok(fh.Filename)
+	})
+
+	tests := []struct {
+		file []byte
+		code int
+		want string
+	}{
+		{pngHead, 200, "me.png"},
+		{[]byte("plain text"), 400, "unsupported file type text/plain"},
+		{append(pngHead, make([]byte, 2<<10)...), 413, "upload is too large"},
+	}
+	for _, tt := range tests {
+		r := multipartRequest("/avatar", nil, map[string][]byte{"avatar": tt.file}, "me.png")
+		w := performRequest(engine, r)
+		if w.Code != tt.code || strings.Contains(w.Body.String(), tt.want) == false {
+			t.Errorf("want %d %s, got %d %s", tt.code, tt.want, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestMultipartReader(t *testing.T) {
+	storage := &MemoryStorage{}
+	engine := create()
+	engine.POST("/upload", Upload(UploadConfig{MaxFileBytes: 20}), func(c *Context) {
+		parts, err := c.MultipartReader()
+		if err != nil {
+			c.Fail(err)
+			return
+		}
+		result := []string{}
+		for parts.Next() {
+			if parts.Part().FileName() == "" {
+				v, _ := parts.Value()
+				result = append(result, parts.Part().FormName()+"="+v)
+				continue
+			}
+			f, err := parts.Save(storage, "files/"+parts.Part().FormName())
+			if err != nil {
+				break
+			}
+			result = append(result, f.Location+":"+f.ContentType)
+		}
+		if err := parts.Err(); err != nil {
+			c.Fail(err)
+			return
+		}
+		c.Ok(strings.Join(result, ","))
+	})
+
+	r := multipartRequest("/upload", map[string]string{"title": "hi"}, map[string][]byte{"doc": []byte("hello")}, "doc.txt")
+	w := performRequest(engine, r)
+	if strings.Contains(w.Body.String(), "title=hi,files/doc:text/plain; charset=utf-8") == false {
+		t.Errorf("want field and file, got %s", w.Body.String())
+	}
+	if b, ok := storage.File("files/doc"); ok == false || string(b) != "hello" {
+		t.Errorf("want stored file, got %q", b)
+	}
+
+	r = multipartRequest("/upload", nil, map[string][]byte{"big": bytes.Repeat([]byte("x"), 30)}, "big.txt")
+	w = performRequest(engine, r)
+	if w.Code != http.StatusRequestEntityTooLarge || strings.Contains(w.Body.String(), "upload is too large") == false {
+		t.Errorf("want too large, got %d %s", w.Code, w.Body.String())
+	}
+	if _, ok := storage.File("files/big"); ok {
+		t.Error("want too large file deleted")
+	}
+}
@@ -0,0 +1,233 @@
+package core
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VersionConfig api versioning config, see RouterGroup.Versioned.
+type VersionConfig struct {
+	Header     string // request header holding the version, default is "API-Version", it is also set on the response
+	Vendor     string // vendor of the media type, "x" matches Accept: application/vnd.x.v2+json, disabled if empty
+	PathPrefix string // also register the routes under /<PathPrefix><version>, e.g. "v" for /v2/users, disabled if empty
+	Default    string // version of the requests without version, default is the latest version of each route
+}
+
+// Deprecation describes a deprecated version, the Deprecation, Sunset and Link headers are set on its responses.
+type Deprecation struct {
+	At     time.Time // deprecation date, zero means deprecated without date
+	Sunset time.Time // date after which the version is removed, not sent if zero
+	Link   string    // url of the migration documentation, not sent if empty
+}
+
+// Versioning dispatches the same path to different handlers by api version.
+//
+//	vs := Routers.Group("/api").Versioned(VersionConfig{Vendor: "x", PathPrefix: "v", Default: "1"})
+//	vs.Version("1").GET("/users", listUsersV1)
+//	vs.Version("2").GET("/users", listUsersV2)
+//	vs.Deprecate("1", Deprecation{Sunset: time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)})
+//
+// A request for a version without the route falls back to the closest lower version having it,
+// so a version only needs to register the routes it changes.
+type Versioning struct {
+	VersionConfig
+	group        *RouterGroup
+	deprecations map[string]*Deprecation
+	routes       map[string]*versionedRoute // routes by method and path
+}
+
+// apiVersion is a version of a Versioning, set on the groups returned by Version.
+type apiVersion struct {
+	versioning *Versioning
+	name       string
+}
+
+// versionedRoute is a path registered by several versions.
+type versionedRoute struct {
+	versions []string // sorted in ascending order
+	chains   map[string]RouterHandlerChain
+}
+
+// Versioned returns the versioning of the group.
+func (group *RouterGroup) Versioned(cfg VersionConfig) *Versioning {
+	if cfg.Header == "" {
+		cfg.Header = "API-Version"
+	}
+	return &Versioning{
+		VersionConfig: cfg,
+		group:         group,
+		deprecations:  make(map[string]*Deprecation),
+		routes:        make(map[string]*versionedRoute),
+	}
+}
+
+// Version returns a router group whose routes belong to the version.
+func (vs *Versioning) Version(version string) *RouterGroup {
+	version = strings.TrimPrefix(version, "v")
+	assert1(version != "", "version can not be empty")
+	return &RouterGroup{
+		Handlers: vs.group.combineHandlers(nil),
+		basePath: vs.group.basePath,
+		engine:   vs.group.engine,
+		version:  &apiVersion{versioning: vs, name: version},
+	}
+}
+
+// Deprecate marks the version as deprecated.
+func (vs *Versioning) Deprecate(version string, d Deprecation) {
+	vs.deprecations[strings.TrimPrefix(version, "v")] = &d
+}
+
+// addRoute registers the handlers of the version, the path is dispatched by version.
+func (v *apiVersion) addRoute(method, path string, handlers RouterHandlerChain) []*RouteInfo {
+	vs := v.versioning
+	engine := vs.group.engine
+	key := method + " " + path
+	vr, exists := vs.routes[key]
+	if exists == false {
+		vr = &versionedRoute{chains: make(map[string]RouterHandlerChain)}
+		vs.routes[key] = vr
+	}
+	_, dup := vr.chains[v.name]
+	assert1(dup == false, "handlers are already registered for path '"+path+"' version "+v.name)
+	vr.chains[v.name] = handlers
+	vr.versions = append(vr.versions, v.name)
+	sort.Slice(vr.versions, func(i, j int) bool { return compareVersions(vr.versions[i], vr.versions[j]) < 0 })
+
+	var (
+		treePath    string
+		constraints []paramConstraint
+	)
+	if exists == false {
+		treePath, constraints = engine.insertRoute(method, path, RouterHandlerChain{vs.negotiate(vr)})
+	} else {
+		treePath, constraints = parseConstraints(path)
+	}
+	r := engine.addRouteInfo(method, treePath, constraints, handlers)
+	r.Version = v.name
+	routes := []*RouteInfo{r}
+
+	if vs.PathPrefix != "" {
+		rel := strings.TrimPrefix(path, vs.group.basePath)
+		prefixed := joinPaths(joinPaths(vs.group.basePath, vs.PathPrefix+v.name), rel)
+		treePath, constraints = engine.insertRoute(method, prefixed, RouterHandlerChain{vs.fixed(v.name, handlers)})
+		r = engine.addRouteInfo(method, treePath, constraints, handlers)
+		r.Version = v.name
+		routes = append(routes, r)
+	}
+	return routes
+}
+
+// negotiate returns a handler running the handlers of the requested version.
+func (vs *Versioning) negotiate(vr *versionedRoute) RouterHandler {
+	return func(ctx *Context) {
+		requested := vs.requested(ctx.Request)
+		if requested == "" {
+			requested = vs.Default
+		}
+		version := ""
+		for _, v := range vr.versions {
+			if requested == "" || compareVersions(v, requested) <= 0 {
+				version = v
+			}
+		}
+		if version == "" {
+			ctx.Fail((&NotFoundError{}).New("API version " + requested + " not found"))
+			return
+		}
+		vs.fixed(version, vr.chains[version])(ctx)
+	}
+}
+
+// fixed returns a handler running the handlers of the version.
+func (vs *Versioning) fixed(version string, handlers RouterHandlerChain) RouterHandler {
+	return func(ctx *Context) {
+		h := ctx.ResponseWriter.Header()
+		h.Set(vs.Header, version)
+		h.Add("Vary", vs.Header)
+		if vs.Vendor != "" {
+			h.Add("Vary", "Accept")
+		}
+		if d := vs.deprecations[version]; d != nil {
+			if d.At.IsZero() {
+				h.Set("Deprecation", "true")
+			} else {
+				h.Set("Deprecation", "@"+strconv.FormatInt(d.At.Unix(), 10))
+			}
+			if d.Sunset.IsZero() == false {
+				h.Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+			}
+			if d.Link != "" {
+				h.Add("Link", "<"+d.Link+`>; rel="deprecation"`)
+			}
+		}
+		for _, handler := range handlers {
+			ctx.handlersStack.Use(handler)
+		}
+		ctx.Next()
+	}
+}
+
+// requested returns the version asked by the request header or media type.
+func (vs *Versioning) requested(r *http.Request) string {
+	if v := r.Header.Get(vs.Header); v != "" {
+		return strings.TrimPrefix(v, "v")
+	}
+	if vs.Vendor == "" {
+		return ""
+	}
+	prefix := "application/vnd." + vs.Vendor
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		parts := strings.Split(accept, ";")
+		mt := strings.TrimSpace(parts[0])
+		if strings.HasPrefix(mt, prefix) == false {
+			continue
+		}
+		// application/vnd.x.v2+json
+		if rest := mt[len(prefix):]; strings.HasPrefix(rest, ".v") {
+			if i := strings.IndexByte(rest, '+'); i > 0 {
+				rest = rest[:i]
+			}
+			return rest[2:]
+		}
+		// application/vnd.x+json; version=2
+		for _, p := range parts[1:] {
+			if kv := strings.SplitN(strings.TrimSpace(p), "=", 2); len(kv) == 2 && kv[0] == "version" {
+				return strings.TrimPrefix(kv[1], "v")
+			}
+		}
+	}
+	return ""
+}
+
+// compareVersions compares dotted versions, numeric parts are compared as numbers.
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		x, y := "0", "0"
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+		xn, xerr := strconv.Atoi(x)
+		yn, yerr := strconv.Atoi(y)
+		switch {
+		case xerr == nil && yerr == nil && xn != yn:
+			if xn < yn {
+				return -1
+			}
+			return 1
+		case (xerr != nil || yerr != nil) && x != y:
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
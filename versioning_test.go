@@ -0,0 +1,69 @@
+package core
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestVersioning(t *testing.T) {
+	engine := create()
+	vs := engine.Group("/api").Versioned(VersionConfig{Vendor: "x", PathPrefix: "v", Default: "1"})
+	vs.Version("1").GET("/users", func(c *Context) { c.Ok("users v1") })
+	vs.Version("1").GET("/orders", func(c *Context) { c.Ok("orders v1") })
+	vs.Version("2").GET("/users", func(c *Context) { c.Ok("users v2") })
+	sunset := time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)
+	vs.Deprecate("1", Deprecation{Sunset: sunset, Link: "https://example.com/v2"})
+
+	tests := []struct {
+		path, header, value string
+		body, version       string
+	}{
+		{"/api/users", "", "", "users v1", "1"},
+		{"/api/users", "API-Version", "2", "users v2", "2"},
+		{"/api/users", "Accept", "application/vnd.x.v2+json", "users v2", "2"},
+		{"/api/users", "Accept", "application/vnd.x+json; version=2", "users v2", "2"},
+		{"/api/orders", "API-Version", "2", "orders v1", "1"},
+		{"/api/v2/users", "", "", "users v2", "2"},
+		{"/api/v1/users", "API-Version", "2", "users v1", "1"},
+	}
+	for _, tt := range tests {
+		r, _ := http.NewRequest("GET", tt.path, nil)
+		if tt.header != "" {
+			r.Header.Set(tt.header, tt.value)
+		}
+		w := performRequest(engine, r)
+		body := `{"ok":true,"data":"` + tt.body + `","message":"","errno":0}`
+		if w.Body.String() != body || w.Header().Get("API-Version") != tt.version {
+			t.Errorf("%s %s=%s: want %s v%s, got %s v%s", tt.path, tt.header, tt.value, body, tt.version, w.Body.String(), w.Header().Get("API-Version"))
+		}
+		deprecated := w.Header().Get("Deprecation") == "true" && w.Header().Get("Sunset") == sunset.Format(http.TimeFormat)
+		if deprecated != (tt.version == "1") {
+			t.Errorf("%s %s=%s: deprecation headers %v", tt.path, tt.header, tt.value, w.Header())
+		}
+	}
+
+	r, _ := http.NewRequest("GET", "/api/users", nil)
+	r.Header.Set("API-Version", "0.9")
+	if w := performRequest(engine, r); w.Code != http.StatusNotFound {
+		t.Errorf("unknown version: want %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1", "2", -1},
+		{"10", "9", 1},
+		{"1.2", "1.10", -1},
+		{"2", "2.0", 0},
+		{"beta", "alpha", 1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q): want %d, got %d", tt.a, tt.b, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,518 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// WebSocket message types, see RFC 6455 section 5.2.
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	CloseMessage  = 8
+	PingMessage   = 9
+	PongMessage   = 10
+)
+
+// WebSocket close codes, see RFC 6455 section 7.4.1.
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	CloseUnsupportedData = 1003
+	CloseNoStatus        = 1005
+	CloseAbnormal        = 1006
+	CloseInvalidPayload  = 1007
+	ClosePolicyViolation = 1008
+	CloseMessageTooBig   = 1009
+	CloseInternalError   = 1011
+)
+
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WSConfig websocket config, see Context.Upgrade.
+type WSConfig struct {
+	ReadLimit    int64                      // max size of a received message, default is 1MB
+	PingInterval time.Duration              // interval of the keepalive pings, default is 30s, negative disables them
+	PongWait     time.Duration              // the connection is closed if nothing is received for PongWait, default is 2 PingIntervals
+	WriteTimeout time.Duration              // timeout of a write, default is 10s
+	Compression  bool                       // negotiate permessage-deflate
+	Subprotocols []string                   // supported subprotocols by order of preference
+	CheckOrigin  func(r *http.Request) bool // default accepts the requests without Origin or from the same host
+}
+
+// DefaultWSConfig is the config of the routes registered by RouterGroup.WS.
+var DefaultWSConfig = WSConfig{Compression: true}
+
+// WSHandler handles a websocket connection, the connection is closed when it returns.
+type WSHandler func(conn *WSConn)
+
+// WSCloseError is returned by ReadMessage when the connection is closed.
+type WSCloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *WSCloseError) Error() string {
+	return "websocket closed: " + strconv.Itoa(e.Code) + " " + e.Reason
+}
+
+// WS registers a websocket route, the request goes through the middlewares of the group before the upgrade,
+// so the session and the principal are available in conn.Ctx:
+//
+//	router.WS("/chat", func(conn *core.WSConn) {
+//		for {
+//			typ, msg, err := conn.ReadMessage()
+//			if err != nil {
+//				return
+//			}
+//			conn.WriteMessage(typ, msg)
+//		}
+//	}, core.RequireRole("user"))
+func (group *RouterGroup) WS(relativePath string, handler WSHandler, middlewares ...RouterHandler) *Route {
+	handlers := append(RouterHandlerChain{}, middlewares...)
+	handlers = append(handlers, func(ctx *Context) {
+		conn, err := ctx.Upgrade(DefaultWSConfig)
+		if err != nil {
+			ctx.Fail(err)
+			return
+		}
+		defer conn.Close(CloseNormal, "")
+		handler(conn)
+	})
+	return group.handle("GET", relativePath, handlers)
+}
+
+// WSConn is a websocket connection. A single goroutine may read, writes are safe for concurrent use.
+type WSConn struct {
+	Ctx         *Context // context of the upgraded request
+	conn        net.Conn
+	br          *bufio.Reader
+	cfg         WSConfig
+	client      bool // frames are masked by the clients
+	compress    bool
+	subprotocol string
+
+	wmu       sync.Mutex
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// Upgrade performs the websocket handshake of the request and hijacks the connection.
+// An error is returned before anything is written if the request is not a valid handshake.
+func (ctx *Context) Upgrade(cfg WSConfig) (*WSConn, error) {
+	r := ctx.Request
+	if r.Method != "GET" ||
+		headerContains(r.Header, "Connection", "upgrade") == false ||
+		headerContains(r.Header, "Upgrade", "websocket") == false {
+		return nil, (&ValidationError{}).New("websocket: not a websocket handshake")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		ctx.ResponseWriter.Header().Set("Sec-WebSocket-Version", "13")
+		return nil, (&ValidationError{}).New("websocket: unsupported version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if b, err := base64.StdEncoding.DecodeString(key); err != nil || len(b) != 16 {
+		return nil, (&ValidationError{}).New("websocket: invalid Sec-WebSocket-Key")
+	}
+	checkOrigin := cfg.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+	if checkOrigin(r) == false {
+		return nil, (&ForbiddenError{}).New("websocket: origin not allowed")
+	}
+	h, ok := ctx.ResponseWriter.(http.Hijacker)
+	if ok == false {
+		return nil, errors.New("websocket: the response writer does not support hijacking")
+	}
+
+	c := &WSConn{Ctx: ctx, cfg: withWSDefaults(cfg), closed: make(chan struct{})}
+	res := "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n"
+	for _, p := range headerTokens(r.Header, "Sec-WebSocket-Protocol") {
+		if inStrings(cfg.Subprotocols, p) {
+			c.subprotocol = p
+			res += "Sec-WebSocket-Protocol: " + p + "\r\n"
+			break
+		}
+	}
+	if cfg.Compression {
+		for _, ext := range headerTokens(r.Header, "Sec-WebSocket-Extensions") {
+			if strings.TrimSpace(strings.Split(ext, ";")[0]) == "permessage-deflate" {
+				c.compress = true
+				res += "Sec-WebSocket-Extensions: permessage-deflate; server_no_context_takeover; client_no_context_takeover\r\n"
+				break
+			}
+		}
+	}
+
+	conn, brw, err := h.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	// Clear the deadlines of the http server.
+	conn.SetDeadline(time.Time{})
+	c.conn, c.br = conn, brw.Reader
+	conn.SetWriteDeadline(time.Now().Add(c.cfg.WriteTimeout))
+	if _, err = conn.Write([]byte(res + "\r\n")); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c.start()
+	return c, nil
+}
+
+func withWSDefaults(cfg WSConfig) WSConfig {
+	if cfg.ReadLimit <= 0 {
+		cfg.ReadLimit = 1 << 20
+	}
+	if cfg.PingInterval == 0 {
+		cfg.PingInterval = 30 * time.Second
+	}
+	if cfg.PongWait <= 0 && cfg.PingInterval > 0 {
+		cfg.PongWait = 2 * cfg.PingInterval
+	}
+	if cfg.WriteTimeout <= 0 {
+		cfg.WriteTimeout = 10 * time.Second
+	}
+	return cfg
+}
+
+// start sets the read deadline and starts the keepalive pings.
+func (c *WSConn) start() {
+	c.extendReadDeadline()
+	if c.cfg.PingInterval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(c.cfg.PingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if c.WriteMessage(PingMessage, nil) != nil {
+					return
+				}
+			case <-c.closed:
+				return
+			}
+		}
+	}()
+}
+
+func (c *WSConn) extendReadDeadline() {
+	if c.cfg.PongWait > 0 {
+		c.conn.SetReadDeadline(time.Now().Add(c.cfg.PongWait))
+	}
+}
+
+// Subprotocol returns the negotiated subprotocol.
+func (c *WSConn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// ReadMessage returns the next text or binary message. Pings are answered, and a *WSCloseError is returned
+// once the peer closed the connection.
+func (c *WSConn) ReadMessage() (int, []byte, error) {
+	var (
+		typ        int
+		compressed bool
+		msg        []byte
+	)
+	for {
+		fin, rsv1, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		c.extendReadDeadline()
+		switch opcode {
+		case PingMessage:
+			if err = c.WriteMessage(PongMessage, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case PongMessage:
+			continue
+		case CloseMessage:
+			ce := &WSCloseError{Code: CloseNoStatus}
+			if len(payload) >= 2 {
+				ce.Code = int(binary.BigEndian.Uint16(payload))
+				ce.Reason = string(payload[2:])
+			}
+			c.Close(ce.Code, "")
+			return 0, nil, ce
+		case TextMessage, BinaryMessage:
+			if typ != 0 {
+				return 0, nil, c.fail(CloseProtocolError, "unexpected data frame")
+			}
+			typ, compressed = opcode, rsv1
+		case 0:
+			if typ == 0 {
+				return 0, nil, c.fail(CloseProtocolError, "unexpected continuation frame")
+			}
+		default:
+			return 0, nil, c.fail(CloseProtocolError, "unknown opcode")
+		}
+		if int64(len(msg)+len(payload)) > c.cfg.ReadLimit {
+			return 0, nil, c.fail(CloseMessageTooBig, "message too big")
+		}
+		msg = append(msg, payload...)
+		if fin == false {
+			continue
+		}
+		if compressed {
+			if msg, err = c.inflate(msg); err != nil {
+				return 0, nil, err
+			}
+		}
+		if typ == TextMessage && utf8.Valid(msg) == false {
+			return 0, nil, c.fail(CloseInvalidPayload, "invalid utf-8")
+		}
+		return typ, msg, nil
+	}
+}
+
+// ReadJSON reads the next message as JSON into v.
+func (c *WSConn) ReadJSON(v interface{}) error {
+	_, msg, err := c.ReadMessage()
+	if err != nil {
+		return err
+	}
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+	return json.Unmarshal(msg, v)
+}
+
+// readFrame reads a frame, control frames are checked.
+func (c *WSConn) readFrame() (fin, rsv1 bool, opcode int, payload []byte, err error) {
+	var h [2]byte
+	if _, err = io.ReadFull(c.br, h[:]); err != nil {
+		return
+	}
+	fin, rsv1, opcode = h[0]&0x80 != 0, h[0]&0x40 != 0, int(h[0]&0x0f)
+	masked := h[1]&0x80 != 0
+	length := int64(h[1] & 0x7f)
+	switch {
+	case h[0]&0x30 != 0 || rsv1 && (c.compress == false || opcode >= CloseMessage || opcode == 0):
+		err = c.fail(CloseProtocolError, "invalid reserved bits")
+		return
+	case masked == c.client:
+		err = c.fail(CloseProtocolError, "invalid frame mask")
+		return
+	case opcode >= CloseMessage && (fin == false || length > 125):
+		err = c.fail(CloseProtocolError, "invalid control frame")
+		return
+	}
+	switch length {
+	case 126:
+		var b [2]byte
+		if _, err = io.ReadFull(c.br, b[:]); err != nil {
+			return
+		}
+		length = int64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		if _, err = io.ReadFull(c.br, b[:]); err != nil {
+			return
+		}
+		length = int64(binary.BigEndian.Uint64(b[:]))
+	}
+	if length < 0 || length > c.cfg.ReadLimit {
+		err = c.fail(CloseMessageTooBig, "message too big")
+		return
+	}
+	var mask [4]byte
+	if masked {
+		if _, err = io.ReadFull(c.br, mask[:]); err != nil {
+			return
+		}
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(c.br, payload); err != nil {
+		return
+	}
+	if masked {
+		maskBytes(mask, payload)
+	}
+	return
+}
+
+// WriteMessage sends a message, data messages are compressed if permessage-deflate was negotiated.
+func (c *WSConn) WriteMessage(typ int, data []byte) error {
+	rsv1 := false
+	if c.compress && (typ == TextMessage || typ == BinaryMessage) && len(data) > 0 {
+		data = deflate(data)
+		rsv1 = true
+	}
+	return c.writeFrame(typ, rsv1, data)
+}
+
+// WriteJSON sends v as a JSON text message.
+func (c *WSConn) WriteJSON(v interface{}) error {
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(TextMessage, b)
+}
+
+func (c *WSConn) writeFrame(opcode int, rsv1 bool, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	select {
+	case <-c.closed:
+		if opcode != CloseMessage {
+			return &WSCloseError{Code: CloseAbnormal, Reason: "connection closed"}
+		}
+	default:
+	}
+
+	b := make([]byte, 0, len(payload)+14)
+	h0 := byte(0x80 | opcode)
+	if rsv1 {
+		h0 |= 0x40
+	}
+	b = append(b, h0)
+	var maskBit byte
+	if c.client {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		b = append(b, maskBit|byte(n))
+	case n <= 0xffff:
+		b = append(b, maskBit|126, byte(n>>8), byte(n))
+	default:
+		b = append(b, maskBit|127)
+		b = append(b, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(b[len(b)-8:], uint64(n))
+	}
+	if c.client {
+		var mask [4]byte
+		rand.Read(mask[:])
+		b = append(b, mask[:]...)
+		start := len(b)
+		b = append(b, payload...)
+		maskBytes(mask, b[start:])
+	} else {
+		b = append(b, payload...)
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(c.cfg.WriteTimeout))
+	_, err := c.conn.Write(b)
+	return err
+}
+
+// Close sends a close frame with the code and reason, and closes the connection.
+func (c *WSConn) Close(code int, reason string) error {
+	var err error
+	c.closeOnce.Do(func() {
+		payload := []byte{}
+		if code != CloseNoStatus {
+			payload = make([]byte, 2, 2+len(reason))
+			binary.BigEndian.PutUint16(payload, uint16(code))
+			payload = append(payload, reason...)
+		}
+		close(c.closed)
+		c.writeFrame(CloseMessage, false, payload)
+		err = c.conn.Close()
+	})
+	return err
+}
+
+// fail closes the connection with the code and returns the matching error.
+func (c *WSConn) fail(code int, reason string) error {
+	c.Close(code, reason)
+	return &WSCloseError{Code: code, Reason: reason}
+}
+
+// inflate decompresses a permessage-deflate message, within the read limit.
+func (c *WSConn) inflate(msg []byte) ([]byte, error) {
+	r := flate.NewReader(io.MultiReader(bytes.NewReader(msg), strings.NewReader("\x00\x00\xff\xff\x01\x00\x00\xff\xff")))
+	defer r.Close()
+	b, err := ioutil.ReadAll(io.LimitReader(r, c.cfg.ReadLimit+1))
+	if err != nil {
+		return nil, c.fail(CloseInvalidPayload, "invalid compressed message")
+	}
+	if int64(len(b)) > c.cfg.ReadLimit {
+		return nil, c.fail(CloseMessageTooBig, "message too big")
+	}
+	return b, nil
+}
+
+var flateWriters = sync.Pool{New: func() interface{} {
+	w, _ := flate.NewWriter(nil, flate.BestSpeed)
+	return w
+}}
+
+// deflate compresses a message without context takeover.
+func deflate(data []byte) []byte {
+	var buf bytes.Buffer
+	w := flateWriters.Get().(*flate.Writer)
+	w.Reset(&buf)
+	w.Write(data)
+	w.Flush()
+	flateWriters.Put(w)
+	return bytes.TrimSuffix(buf.Bytes(), []byte{0x00, 0x00, 0xff, 0xff})
+}
+
+func maskBytes(mask [4]byte, b []byte) {
+	for i := range b {
+		b[i] ^= mask[i&3]
+	}
+}
+
+func acceptKey(key string) string {
+	h := sha1.Sum([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// sameOrigin accepts the requests without Origin or whose Origin is the requested host.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// headerTokens returns the comma separated values of the header.
+func headerTokens(h http.Header, name string) []string {
+	var tokens []string
+	for _, v := range h[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				tokens = append(tokens, t)
+			}
+		}
+	}
+	return tokens
+}
+
+func headerContains(h http.Header, name, token string) bool {
+	for _, t := range headerTokens(h, name) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package core
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func wsServer(t *testing.T) *httptest.Server {
+	engine := create()
+	engine.Use(func(c *Context) {
+		c.Data["user"] = "alice"
+		c.Next()
+	})
+	engine.WS("/echo", func(conn *WSConn) {
+		for {
+			typ, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if string(msg) == "who" {
+				msg = []byte(conn.Ctx.Data["user"].(string))
+			}
+			if err = conn.WriteMessage(typ, msg); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	})
+	hs := NewHandlersStack()
+	hs.Use(engine.handlers)
+	return httptest.NewServer(hs)
+}
+
+func TestWebSocket(t *testing.T) {
+	srv := wsServer(t)
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "http://")
+
+	for _, ext := range []string{"", "permessage-deflate; client_max_window_bits"} {
+		header := http.Header{}
+		if ext != "" {
+			header.Set("Sec-WebSocket-Extensions", ext)
+		}
+		conn, res, err := dialWS(addr, "/echo", header)
+		if err != nil || conn == nil {
+			t.Fatalf("want upgrade, got %v %v", res, err)
+		}
+		if conn.compress != (ext != "") {
+			t.Errorf("want compression %v, got %v", ext != "", conn.compress)
+		}
+		big := strings.Repeat("x", 70000)
+		for _, msg := range []string{"hello", "who", big} {
+			conn.WriteMessage(TextMessage, []byte(msg))
+			typ, got, err := conn.ReadMessage()
+			want := msg
+			if msg == "who" {
+				want = "alice"
+			}
+			if err != nil || typ != TextMessage || string(got) != want {
+				t.Errorf("want echo of %.10s, got %d %.10s %v", want, typ, got, err)
+			}
+		}
+
+		// Pings are answered with the same payload.
+		conn.writeFrame(PingMessage, false, []byte("p"))
+		if _, _, opcode, payload, _ := conn.readFrame(); opcode != PongMessage || string(payload) != "p" {
+			t.Errorf("want pong p, got %d %s", opcode, payload)
+		}
+
+		conn.Close(CloseNormal, "bye")
+	}
+}
+
+func TestWebSocketLimits(t *testing.T) {
+	defer func(cfg WSConfig) { DefaultWSConfig = cfg }(DefaultWSConfig)
+	DefaultWSConfig.ReadLimit = 10
+	srv := wsServer(t)
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "http://")
+
+	conn, _, err := dialWS(addr, "/echo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.WriteMessage(TextMessage, []byte("more than ten bytes"))
+	_, _, err = conn.ReadMessage()
+	if ce, ok := err.(*WSCloseError); ok == false || ce.Code != CloseMessageTooBig {
+		t.Errorf("want close %d, got %v", CloseMessageTooBig, err)
+	}
+
+	res, err := http.Get(srv.URL + "/echo")
+	if err != nil || res.StatusCode != http.StatusBadRequest {
+		t.Errorf("want 400 for a plain GET, got %v %v", res, err)
+	}
+	_, res, _ = dialWS(addr, "/echo", http.Header{"Origin": {"http://evil.example.com"}})
+	if res == nil || res.StatusCode != http.StatusForbidden {
+		t.Errorf("want 403 for a foreign origin, got %v", res)
+	}
+}
+
+// dialWS opens a client connection, sending the header.
+func dialWS(addr, path string, header http.Header) (*WSConn, *http.Response, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	key := make([]byte, 16)
+	rand.Read(key)
+	req := fmt.Sprintf("GET %s HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: %s\r\n", path, addr, base64.StdEncoding.EncodeToString(key))
+	for k, vs := range header {
+		for _, v := range vs {
+			req += k + ": " + v + "\r\n"
+		}
+	}
+	if _, err = conn.Write([]byte(req + "\r\n")); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	br := bufio.NewReader(conn)
+	res, err := http.ReadResponse(br, nil)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		return nil, res, nil
+	}
+	if res.Header.Get("Sec-WebSocket-Accept") != acceptKey(base64.StdEncoding.EncodeToString(key)) {
+		conn.Close()
+		return nil, res, fmt.Errorf("invalid Sec-WebSocket-Accept")
+	}
+	c := &WSConn{conn: conn, br: br, client: true, closed: make(chan struct{}), cfg: withWSDefaults(WSConfig{PingInterval: -1})}
+	c.compress = strings.HasPrefix(res.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate")
+	return c, res, nil
+}